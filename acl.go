@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// aclFile restricts which recipients are able to read an entry. It lives in
+// the root of the bag and contains a list of rules such as:
+//
+//	# production credentials are for alice and bob only
+//	- pattern: "^prod-"
+//	  recipients:
+//	    - alice@example.com
+//	    - SHA256:4f0Bx3...
+//
+// Patterns match entry names the same way filters of 'scum list' are, see
+// matchFilter: patterns containing '/' or '**' are globs on the path of the
+// entry, all others are regular expressions matched against the whole path,
+// so "^prod-" does not match 'team/prod-db'. Unlike filters, an invalid
+// pattern is an error. Recipients are given either by fingerprint
+// or by the comment of their key in the recipients file, a comment must
+// belong to a single key. Entries matching at least one rule are encrypted
+// for the recipients of all matching rules only, all other entries are
+// encrypted for every recipient.
+const aclFile = ".acl"
+
+type aclRule struct {
+	Pattern    string   `yaml:"pattern"`
+	Recipients []string `yaml:"recipients"`
+}
+
+type ACL []aclRule
+
+// Restrict returns a copy of c which only encrypts for the recipients
+// allowed to read the entry called name. rs are the recipients of the bag,
+// used to resolve recipients given by comment.
+func (acl ACL) Restrict(c Crypt, rs []bagRecipient, name string) (Crypt, error) {
+	matched := false
+	fingerprints := []string{}
+	for _, rule := range acl {
+		re, err := filterRegexp(rule.Pattern)
+		if err != nil {
+			return c, fmt.Errorf("acl pattern '%s' is invalid: %s", rule.Pattern, err.Error())
+		}
+		if !re.MatchString(name) {
+			continue
+		}
+		matched = true
+
+		for _, id := range rule.Recipients {
+			fp, err := resolveRecipient(c, rs, id)
+			if err != nil {
+				return c, err
+			}
+			fingerprints = append(fingerprints, fp)
+		}
+	}
+
+	if !matched {
+		return c, nil
+	}
+
+	restricted := c.Restrict(fingerprints)
+	if len(restricted.Fingerprints()) == 0 {
+		return c, fmt.Errorf("acl does not allow anybody to read '%s'", name)
+	}
+	return restricted, nil
+}
+
+// ReplaceRecipient returns a copy of the acl where every reference to the
+// recipient old is replaced by new.
+func (acl ACL) ReplaceRecipient(old, new string) (ACL, bool) {
+	out := ACL{}
+	replaced := false
+	for _, rule := range acl {
+		r := aclRule{Pattern: rule.Pattern}
+		for _, id := range rule.Recipients {
+			if id == old {
+				id = new
+				replaced = true
+			}
+			r.Recipients = append(r.Recipients, id)
+		}
+		out = append(out, r)
+	}
+	return out, replaced
+}
+
+// resolveRecipient returns the fingerprint of the recipient identified by
+// id, which is either a fingerprint or the comment of a key. Anybody able to
+// add a key to the recipients file picks its comment, a comment shared by
+// several keys is therefore refused rather than granting access to all of
+// them.
+func resolveRecipient(c Crypt, rs []bagRecipient, id string) (string, error) {
+	for _, fp := range c.Fingerprints() {
+		if fp == id {
+			return fp, nil
+		}
+	}
+
+	found := []string{}
+	for _, r := range rs {
+		if r.Comment == id {
+			found = append(found, r.Fingerprint())
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("acl refers to unknown recipient '%s'", id)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("recipient '%s' is ambiguous, it is the comment of the keys %s, refer to the key by its fingerprint instead", id, strings.Join(found, ", "))
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+func testRecipientLine(t *testing.T, comment string) string {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.Type() + " " + base64.StdEncoding.EncodeToString(key.Marshal()) + " " + comment + "\n"
+}
+
+func TestACLRefusesAmbiguousComments(t *testing.T) {
+	data := testRecipientLine(t, "alice@example.com") + testRecipientLine(t, "bob@example.com") + testRecipientLine(t, "bob@example.com")
+	rs, err := parseRecipients([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Crypt{}
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+
+	if fp, err := resolveRecipient(c, rs, "alice@example.com"); err != nil || fp != rs[0].Fingerprint() {
+		t.Fatalf("unexpected recipient %s: %v", fp, err)
+	}
+	if fp, err := resolveRecipient(c, rs, rs[1].Fingerprint()); err != nil || fp != rs[1].Fingerprint() {
+		t.Fatalf("unexpected recipient %s: %v", fp, err)
+	}
+	if _, err := resolveRecipient(c, rs, "bob@example.com"); err == nil {
+		t.Fatal("ambiguous comment accepted")
+	}
+
+	acl := ACL{{Pattern: "^prod", Recipients: []string{"bob@example.com"}}}
+	if _, err := acl.Restrict(c, rs, "prod"); err == nil {
+		t.Fatal("entry restricted to an ambiguous recipient")
+	}
+}
+
+func TestACLMatchesLikeFilters(t *testing.T) {
+	data := testRecipientLine(t, "alice@example.com") + testRecipientLine(t, "bob@example.com")
+	rs, err := parseRecipients([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Crypt{}
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+	alice := rs[0].Fingerprint()
+
+	for _, tc := range []struct {
+		pattern string
+		name    string
+		matched bool
+	}{
+		{"clients/**", "clients/acme/prod", true},
+		{"clients/**", "prod", false},
+		{"clients/acme", "clients/acme/prod", true},
+		{"**/prod-*", "team/prod-db", true},
+		{"**/prod-*", "prod-db", true},
+		{"^prod-", "prod-db", true},
+		{"^prod-", "team/prod-db", false},
+		{"prod-", "team/prod-db", true},
+	} {
+		acl := ACL{{Pattern: tc.pattern, Recipients: []string{"alice@example.com"}}}
+		restricted, err := acl.Restrict(c, rs, tc.name)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.pattern, err)
+		}
+		if got := len(restricted.Fingerprints()) == 1 && restricted.Fingerprints()[0] == alice; got != tc.matched {
+			t.Errorf("%s on %s: expected match %v", tc.pattern, tc.name, tc.matched)
+		}
+		if matchFilter(tc.pattern, tc.name) != tc.matched {
+			t.Errorf("%s on %s: filter and acl disagree", tc.pattern, tc.name)
+		}
+	}
+
+	acl := ACL{{Pattern: "prod-(", Recipients: []string{"alice@example.com"}}}
+	if _, err := acl.Restrict(c, rs, "prod-db"); err == nil {
+		t.Fatal("invalid pattern accepted")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// BIP 173 test vectors, all of them carry a valid checksum.
+var bech32Valid = []string{
+	"A12UEL5L",
+	"a12uel5l",
+	"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+	"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+	"11qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqc8247j",
+	"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	"?1ezyfcl",
+}
+
+// BIP 173 test vectors which must be rejected, except the one exceeding the
+// length limit which age keys do not observe.
+var bech32Invalid = []string{
+	"\x201nwldj5",
+	"\x7f1axkwrx",
+	"\x801eym55h",
+	"pzry9x0s0muk",
+	"1pzry9x0s0muk",
+	"x1b4n0q5v",
+	"li1dgmt3",
+	"de1lg7wt\xff",
+	"A1G7SGD8",
+	"10a06t8",
+	"1qzzfhee",
+}
+
+func TestBech32Vectors(t *testing.T) {
+	for _, s := range bech32Valid {
+		pos := strings.LastIndex(s, "1")
+		values := []byte{}
+		for _, c := range strings.ToLower(s[pos+1:]) {
+			values = append(values, byte(strings.IndexRune(bech32Charset, c)))
+		}
+		if bech32Polymod(append(bech32HRPExpand(strings.ToLower(s[:pos])), values...)) != 1 {
+			t.Errorf("%s: invalid checksum", s)
+		}
+
+		// only some of the vectors hold whole bytes
+		hrp, data, err := bech32Decode(s)
+		if err != nil {
+			continue
+		}
+		out, err := bech32Encode(hrp, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != strings.ToLower(s) {
+			t.Errorf("%s: encoded as %s", s, out)
+		}
+	}
+
+	for _, s := range bech32Invalid {
+		if _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestBech32AgeKeys(t *testing.T) {
+	// the example of the age README
+	hrp, data, err := bech32Decode("age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hrp != ageRecipientPrefix || len(data) != 32 {
+		t.Fatalf("unexpected recipient %s with %d bytes", hrp, len(data))
+	}
+	if _, _, err := (ageKeys{}).ParseRecipient([]byte("age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the X25519 key pair of Alice from RFC 7748, section 6.1, encoded by the
+	// reference implementation of BIP 173
+	identity := "AGE-SECRET-KEY-1WURK6ZNNRZJH60QKC9E9RVNXGH05CTU8A0QFJ243WLA628DE9S4QRFH26J"
+	recipient := "age1s5s0qzvfxzn4gayt0hwtg0hhtgxm7wsdycup4a8t5j5ca25mfe4qt4hs7q"
+	priv, _ := hex.DecodeString("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+
+	hrp, data, err = bech32Decode(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hrp != ageIdentityPrefix || !bytes.Equal(data, priv) {
+		t.Fatalf("unexpected identity %s %x", hrp, data)
+	}
+	if out, err := bech32Encode(ageIdentityPrefix, priv); err != nil || strings.ToUpper(out) != identity {
+		t.Fatalf("identity encoded as %s: %v", out, err)
+	}
+
+	id, err := (ageKeys{}).ParseIdentity([]byte("# created: 2019-12-27\n"+identity+"\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Fingerprint() != recipient {
+		t.Fatalf("identity has recipient %s instead of %s", id.Fingerprint(), recipient)
+	}
+}
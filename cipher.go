@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	crMu sync.Mutex
+	cr   = CipherRegistry{}
+)
+
+// CipherRegistry holds the backends able to encrypt entries for a key pair,
+// the backend of the user is chosen with the option 'cipher' of the
+// configuration. Keys of all backends can be mixed in the recipients file of
+// a bag.
+type CipherRegistry map[string]Cipher
+
+// List returns the names of all backends in alphabetical order.
+func (c CipherRegistry) List() []string {
+	out := []string{}
+	for name := range c {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ordered returns the names of all backends with first in front.
+func (c CipherRegistry) ordered(first string) []string {
+	out := []string{}
+	if _, ok := c[first]; ok {
+		out = append(out, first)
+	}
+	for _, name := range c.List() {
+		if name != first {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func (c CipherRegistry) Describe(name string) (string, error) {
+	cipher, err := NewCipher(name)
+	if err != nil {
+		return "", err
+	}
+	return cipher.Describe(), nil
+}
+
+func RegisterCipher(name string, cipher Cipher) {
+	crMu.Lock()
+	defer crMu.Unlock()
+	if _, dup := cr[name]; dup {
+		panic("Register called twice for cipher " + name)
+	}
+	cr[name] = cipher
+}
+
+func NewCipher(name string) (Cipher, error) {
+	cipher, ok := cr[name]
+	if !ok {
+		return nil, fmt.Errorf("Cipher '%s' does not exist, must be one of the following: %s", name, strings.Join(cr.List(), ", "))
+	}
+	return cipher, nil
+}
+
+// Cipher is a backend turning the keys of a user into a recipient and an
+// identity, see key_*.go.
+type Cipher interface {
+	// Describe explains the backend and the format of its keys.
+	Describe() string
+	// ParseRecipient reads a public key as found in a line of the
+	// recipients file and returns it along with its comment.
+	ParseRecipient(line []byte) (recipient, string, error)
+	// ParseIdentity reads a private key file, pass decrypts the key if it
+	// is encrypted.
+	ParseIdentity(data, pass []byte) (identity, error)
+	// NewSigner returns a signer for the private key, or nil if the backend
+	// is unable to sign.
+	NewSigner(data, pass []byte) (ssh.Signer, error)
+}
+
+// errCipherMismatch is returned by the methods of a Cipher for keys of other
+// backends.
+var errCipherMismatch = fmt.Errorf("key does not belong to cipher")
+
+// parseCipherRecipient reads a public key of any backend but the insecure
+// one, the name of the backend is returned as well.
+func parseCipherRecipient(line []byte) (string, recipient, string, error) {
+	for _, name := range cr.List() {
+		// the file key would be stored in plain text for such a recipient,
+		// it is only used as the key of the user if configured explicitly
+		if name == insecureCipher {
+			continue
+		}
+		r, comment, err := cr[name].ParseRecipient(line)
+		if err == errCipherMismatch {
+			continue
+		}
+		return name, r, comment, err
+	}
+
+	if _, _, err := (insecureKeys{}).ParseRecipient(line); err == nil {
+		return "", nil, "", fmt.Errorf("'%s' keys are for tests only and cannot be recipients, set 'cipher: %s' to use one as your own key", insecureCipher, insecureCipher)
+	}
+
+	// tell about unsupported ssh keys
+	if pub, _, _, _, err := ssh.ParseAuthorizedKey(line); err == nil {
+		return "", nil, "", fmt.Errorf("key type %s is not supported, use one of the following ciphers: %s", pub.Type(), strings.Join(cr.List(), ", "))
+	}
+	return "", nil, "", fmt.Errorf("key is not supported by any cipher (%s)", strings.Join(cr.List(), ", "))
+}
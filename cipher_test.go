@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestInsecureRecipientRejected(t *testing.T) {
+	for _, data := range []string{"insecure\n", "insecure attacker\n"} {
+		if _, err := parseRecipients([]byte(data)); err == nil {
+			t.Errorf("%q accepted as recipient", data)
+		}
+	}
+	if _, _, _, err := parseCipherRecipient([]byte("insecure")); err == nil {
+		t.Error("insecure key detected without being configured")
+	}
+
+	// the explicitly configured cipher still reads it
+	c, err := NewCipher(insecureCipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ParseRecipient([]byte("insecure")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,9 +3,17 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 	"gopkg.in/yaml.v2"
 )
 
@@ -14,8 +22,25 @@ type App struct {
 		configPath   string
 		flagKind     string
 		mountTimeout int
+		oldPrivate   string
+		newPublic    string
+		breakGlass   bool
+		threshold    int
+		shareFor     string
+		description  string
+		owner        string
+		showMeta     bool
+		selector     string
 	}
 
+	// daemon is set if a scum agent holding the key of the user is running,
+	// daemonUnlocked if it is used instead of the private key file
+	daemon         *daemonClient
+	daemonUnlocked bool
+
+	// pw is the passphrase once it was asked for, see passphrase
+	pw *SecretBuffer
+
 	// entry point
 	Execute func() error
 }
@@ -29,6 +54,7 @@ func NewApp() *App {
 		Short: "Secret Credentials Utility/Manager",
 	}
 	rootCmd.PersistentFlags().StringVarP(&a.cfg.configPath, "config", "c", os.ExpandEnv("$HOME/.config/scum/config.yml"), "Configuration file for scum")
+	rootCmd.PersistentFlags().BoolVar(&a.cfg.breakGlass, "break-glass", false, "Decrypt entries with the passphrase of a passphrase recipient instead of the private key")
 	a.Execute = rootCmd.Execute
 
 	// types
@@ -39,12 +65,22 @@ func NewApp() *App {
 	}
 	rootCmd.AddCommand(typesCmd)
 
+	// ciphers
+	ciphersCmd := &cobra.Command{
+		Use:   "ciphers",
+		Short: "Show information about the supported key pairs",
+		Run:   a.ciphersCmd,
+	}
+	rootCmd.AddCommand(ciphersCmd)
+
 	// list
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List credential",
 		Run:   a.listCmd,
 	}
+	listCmd.PersistentFlags().StringVarP(&a.cfg.selector, "selector", "l", "", "Only entries whose tags match the selector, e.g. env=prod,team!=legacy")
+	listCmd.PersistentFlags().BoolVar(&a.cfg.showMeta, "meta", false, "Show encrypted metadata as well, which requires the passphrase")
 	rootCmd.AddCommand(listCmd)
 
 	// add
@@ -54,6 +90,8 @@ func NewApp() *App {
 		Run:   a.addCmd,
 	}
 	addCmd.PersistentFlags().StringVarP(&a.cfg.flagKind, "type", "t", "aws", "Profile type")
+	addCmd.PersistentFlags().StringVar(&a.cfg.description, "description", "", "Description of the credential")
+	addCmd.PersistentFlags().StringVar(&a.cfg.owner, "owner", "", "Owner of the credential, defaults to the comment of your public key")
 	rootCmd.AddCommand(addCmd)
 
 	// edit
@@ -61,26 +99,31 @@ func NewApp() *App {
 		Use:   "edit",
 		Short: "Edit an existing set of credential in $EDITOR",
 		Run:   a.editCmd,
-		Args:  cobra.MinimumNArgs(1),
+		Args:  a.patternsOrSelector,
 	}
+	editCmd.PersistentFlags().StringVarP(&a.cfg.selector, "selector", "l", "", "Only entries whose tags match the selector, e.g. env=prod,team!=legacy")
+	editCmd.PersistentFlags().StringVar(&a.cfg.description, "description", "", "Change the description of the credential")
+	editCmd.PersistentFlags().StringVar(&a.cfg.owner, "owner", "", "Change the owner of the credential")
 	rootCmd.AddCommand(editCmd)
 
 	// show
 	showCmd := &cobra.Command{
 		Use:   "show",
 		Short: "Show set of credential",
-		Args:  cobra.MinimumNArgs(1),
+		Args:  a.patternsOrSelector,
 		Run:   a.showCmd,
 	}
+	showCmd.PersistentFlags().StringVarP(&a.cfg.selector, "selector", "l", "", "Only entries whose tags match the selector, e.g. env=prod,team!=legacy")
 	rootCmd.AddCommand(showCmd)
 
 	// mount
 	mountCmd := &cobra.Command{
 		Use:   "mount",
 		Short: "Mount a set of credential",
-		Args:  cobra.MinimumNArgs(1),
+		Args:  a.patternsOrSelector,
 		Run:   a.mountCmd,
 	}
+	mountCmd.PersistentFlags().StringVarP(&a.cfg.selector, "selector", "l", "", "Only entries whose tags match the selector, e.g. env=prod,team!=legacy")
 	mountCmd.PersistentFlags().IntVar(&a.cfg.mountTimeout, "timeout", a.cfg.mountTimeout, "Timeout of the mount in seconds")
 	rootCmd.AddCommand(mountCmd)
 
@@ -88,20 +131,225 @@ func NewApp() *App {
 	rotateCmd := &cobra.Command{
 		Use:   "rotate",
 		Short: "Rotate credential",
-		Args:  cobra.MinimumNArgs(1),
+		Args:  a.patternsOrSelector,
 		Run:   a.rotateCmd,
 	}
+	rotateCmd.PersistentFlags().StringVarP(&a.cfg.selector, "selector", "l", "", "Only entries whose tags match the selector, e.g. env=prod,team!=legacy")
 	rootCmd.AddCommand(rotateCmd)
 
 	// verify
 	verifyCmd := &cobra.Command{
 		Use:   "verify",
 		Short: "Verify a set of credential",
-		Args:  cobra.MinimumNArgs(1),
+		Args:  a.patternsOrSelector,
 		Run:   a.verifyCmd,
 	}
+	verifyCmd.PersistentFlags().StringVarP(&a.cfg.selector, "selector", "l", "", "Only entries whose tags match the selector, e.g. env=prod,team!=legacy")
 	rootCmd.AddCommand(verifyCmd)
 
+	// tag
+	tagCmd := &cobra.Command{
+		Use:   "tag <name> [key=value|key-]...",
+		Short: "Set (key=value) or remove (key-) tags of the matching entries, or show their tags",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   a.tagCmd,
+	}
+	rootCmd.AddCommand(tagCmd)
+
+	// history
+	historyCmd := &cobra.Command{
+		Use:   "history <name>",
+		Short: "List the previous revisions kept of an entry",
+		Args:  cobra.ExactArgs(1),
+		Run:   a.historyCmd,
+	}
+	rootCmd.AddCommand(historyCmd)
+
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback <name> <revision>",
+		Short: "Restore a previous revision of an entry, the current one is kept in its history",
+		Args:  cobra.ExactArgs(2),
+		Run:   a.rollbackCmd,
+	}
+	rootCmd.AddCommand(rollbackCmd)
+
+	diffCmd := &cobra.Command{
+		Use:   "diff <name> <revision>",
+		Short: "Show the fields of an entry which changed since a previous revision",
+		Args:  cobra.ExactArgs(2),
+		Run:   a.diffCmd,
+	}
+	rootCmd.AddCommand(diffCmd)
+
+	// recipients
+	recipientsCmd := &cobra.Command{
+		Use:   "recipients",
+		Short: "Manage the public keys the entries of the bag are encrypted for",
+	}
+	rootCmd.AddCommand(recipientsCmd)
+
+	recipientsListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List recipients",
+		Run:   a.recipientsListCmd,
+	}
+	recipientsCmd.AddCommand(recipientsListCmd)
+
+	recipientsAddCmd := &cobra.Command{
+		Use:   "add <public key file>",
+		Short: "Add all public keys found in a file (authorized_keys format) and re-encrypt all entries",
+		Args:  cobra.ExactArgs(1),
+		Run:   a.recipientsAddCmd,
+	}
+	recipientsCmd.AddCommand(recipientsAddCmd)
+
+	recipientsRemoveCmd := &cobra.Command{
+		Use:   "remove <fingerprint>",
+		Short: "Remove a public key and re-encrypt all entries",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   a.recipientsRemoveCmd,
+	}
+	recipientsCmd.AddCommand(recipientsRemoveCmd)
+
+	recipientsAddPassphraseCmd := &cobra.Command{
+		Use:   "add-passphrase [comment]",
+		Short: "Add a recipient derived from a passphrase, usable with --break-glass if a private key is lost, and re-encrypt all entries",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   a.recipientsAddPassphraseCmd,
+	}
+	recipientsCmd.AddCommand(recipientsAddPassphraseCmd)
+
+	recipientsSyncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Re-encrypt all entries not encrypted for the current recipients, e.g. after changing the acl or to resume an interrupted add or remove",
+		Run:   a.recipientsSyncCmd,
+	}
+	recipientsCmd.AddCommand(recipientsSyncCmd)
+
+	// signers
+	signersCmd := &cobra.Command{
+		Use:   "signers",
+		Short: "Manage the public keys trusted to sign the entries of the bag",
+	}
+	rootCmd.AddCommand(signersCmd)
+
+	signersListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List trusted signers",
+		Run:   a.signersListCmd,
+	}
+	signersCmd.AddCommand(signersListCmd)
+
+	signersAddCmd := &cobra.Command{
+		Use:   "add <public key file>",
+		Short: "Trust all public keys found in a file (authorized_keys format)",
+		Args:  cobra.ExactArgs(1),
+		Run:   a.signersAddCmd,
+	}
+	signersCmd.AddCommand(signersAddCmd)
+
+	signersRemoveCmd := &cobra.Command{
+		Use:   "remove <fingerprint>",
+		Short: "Stop trusting a public key",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   a.signersRemoveCmd,
+	}
+	signersCmd.AddCommand(signersRemoveCmd)
+
+	// rekey
+	rekeyCmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "Re-encrypt all entries for a new key pair",
+		Run:   a.rekeyCmd,
+	}
+	rekeyCmd.PersistentFlags().StringVar(&a.cfg.oldPrivate, "old-private", "", "Private key the entries are currently encrypted for")
+	rekeyCmd.PersistentFlags().StringVar(&a.cfg.newPublic, "new-public", "", "Public key the entries should be encrypted for")
+	rekeyCmd.MarkPersistentFlagRequired("old-private")
+	rekeyCmd.MarkPersistentFlagRequired("new-public")
+	rootCmd.AddCommand(rekeyCmd)
+
+	// recover
+	recoverCmd := &cobra.Command{
+		Use:   "recover <share file>",
+		Short: "Reassemble the recovery key from the shares collected in a file and re-encrypt all entries for the current recipients",
+		Args:  cobra.ExactArgs(1),
+		Run:   a.recoverCmd,
+	}
+	rootCmd.AddCommand(recoverCmd)
+
+	recoverInitCmd := &cobra.Command{
+		Use:   "init <holder...>",
+		Short: "Create a recovery key for the bag and split it among the given recipients (fingerprints or key comments)",
+		Args:  cobra.MinimumNArgs(2),
+		Run:   a.recoverInitCmd,
+	}
+	recoverInitCmd.PersistentFlags().IntVar(&a.cfg.threshold, "threshold", 2, "Number of shares required to recover the bag")
+	recoverCmd.AddCommand(recoverInitCmd)
+
+	recoverShareCmd := &cobra.Command{
+		Use:   "share <share file>",
+		Short: "Add your share of the recovery key to a share file, encrypted for the person doing the recovery",
+		Args:  cobra.ExactArgs(1),
+		Run:   a.recoverShareCmd,
+	}
+	recoverShareCmd.PersistentFlags().StringVar(&a.cfg.shareFor, "for", "", "Public key of the person doing the recovery")
+	recoverShareCmd.MarkPersistentFlagRequired("for")
+	recoverCmd.AddCommand(recoverShareCmd)
+
+	// agent
+	agentCmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Run a daemon holding the unlocked private key, so that the passphrase is not asked for by every command",
+		Run:   a.agentCmd,
+	}
+	rootCmd.AddCommand(agentCmd)
+
+	agentUnlockCmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Unlock the private key held by the scum agent",
+		Run:   a.agentUnlockCmd,
+	}
+	agentCmd.AddCommand(agentUnlockCmd)
+
+	agentLockCmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Make the scum agent forget the private key",
+		Run:   a.agentLockCmd,
+	}
+	agentCmd.AddCommand(agentLockCmd)
+
+	agentStatusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show whether the scum agent is running and unlocked",
+		Run:   a.agentStatusCmd,
+	}
+	agentCmd.AddCommand(agentStatusCmd)
+
+	// forget
+	forgetCmd := &cobra.Command{
+		Use:   "forget",
+		Short: "Remove the passphrase cached in the kernel keyring",
+		Run:   a.forgetCmd,
+	}
+	rootCmd.AddCommand(forgetCmd)
+
+	// hide
+	hideCmd := &cobra.Command{
+		Use:   "hide",
+		Short: "Store the entries under random IDs and their names in an encrypted manifest, so the bag directory does not reveal them",
+		Run:   a.hideCmd,
+	}
+	rootCmd.AddCommand(hideCmd)
+
+	// copy
+	copyCmd := &cobra.Command{
+		Use:   "copy <config file>",
+		Short: "Copy all files of the bag to the empty bag of another configuration, e.g. to move it to another store",
+		Args:  cobra.ExactArgs(1),
+		Run:   a.copyCmd,
+	}
+	rootCmd.AddCommand(copyCmd)
+
 	// config
 	configCmd := &cobra.Command{
 		Use:   "config",
@@ -121,6 +369,436 @@ func NewApp() *App {
 	return a
 }
 
+// newStore opens the storage backend of the bag as configured, a vault is
+// decrypted right away.
+func (a *App) newStore(cfg config) (Store, error) {
+	switch cfg.Store {
+	case storeVault:
+		c, err := a.newCrypt(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return openVaultStore(cfg.BagPath, c, func() (*SecretBuffer, error) { return a.passphrase(cfg) })
+	case storeS3:
+		return newS3Store(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3Prefix)
+	}
+	return newDirStore(cfg.BagPath)
+}
+
+// newBag opens the bag as configured.
+func (a *App) newBag(cfg config) (Bag, error) {
+	s, err := a.newStore(cfg)
+	if err != nil {
+		return Bag{}, err
+	}
+	b, err := NewBag(s)
+	b.KeepHistory(cfg.History)
+	return b, err
+}
+
+// newCrypt sets up the encryption as configured.
+func (a *App) newCrypt(cfg config) (Crypt, error) {
+	c, err := NewCrypt(cfg.Cipher, cfg.PublicKey, cfg.PrivateKey)
+	if err != nil {
+		return c, err
+	}
+	p, err := newPadding(cfg.Padding, cfg.PaddingBlock)
+	if err != nil {
+		return c, err
+	}
+	c.UsePadding(p)
+	c.UseLegacyPolicy(cfg.LegacyEntries)
+
+	if a.cfg.breakGlass {
+		c.UseBreakGlass()
+		return c, nil
+	}
+	if !cfg.SSHAgent {
+		a.useDaemon(cfg, &c)
+		return c, nil
+	}
+
+	sshAgent, err := dialAgent()
+	if err != nil {
+		return c, err
+	}
+	return c, c.UseAgent(sshAgent)
+}
+
+// useDaemon makes c use the scum agent if it is running and holds the key of
+// the user. A locked agent is unlocked once the passphrase is prompted for.
+func (a *App) useDaemon(cfg config, c *Crypt) {
+	client := daemonClient{socket: cfg.AgentSocket}
+	st, err := client.Status()
+	if err != nil || st.Fingerprint != c.Fingerprint() {
+		return
+	}
+	a.daemon = &client
+	a.daemonUnlocked = st.Unlocked && c.UseDaemon(client) == nil
+}
+
+// trustSigners makes c verify the signatures of entries against the keys
+// pinned in the configuration and the signers of the bag they vouch for.
+// Without pinned keys the signers file of the bag cannot be trusted, it is
+// only used to warn about entries signed by others.
+func (a *App) trustSigners(cfg config, b Bag, c *Crypt) error {
+	refuse := cfg.Signatures == signaturesRefuse
+	if len(cfg.TrustedSigners) == 0 {
+		if refuse {
+			return fmt.Errorf("signatures: %s requires the keys trusted to sign to be pinned with trusted_signers", signaturesRefuse)
+		}
+		ss, err := b.Signers()
+		if err != nil || ss == nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "warning: the signers of scum bag '%s' are not authenticated, pin the keys trusted to sign with trusted_signers\n", b.Base)
+		fps := []string{}
+		for _, s := range ss {
+			fps = append(fps, s.Fingerprint())
+		}
+		c.TrustSigners(fps, false)
+		return nil
+	}
+
+	trusted, err := b.TrustedSigners(cfg.TrustedSigners)
+	if err != nil {
+		if refuse {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s, only the keys of trusted_signers are trusted\n", err.Error())
+	}
+	c.TrustSigners(trusted, refuse)
+	return nil
+}
+
+// checkPinned tells the user if the signers file they signed with c will not
+// be trusted by anybody who pins the same keys.
+func (a *App) checkPinned(cfg config, c Crypt) {
+	for _, fp := range cfg.TrustedSigners {
+		if fp == c.Fingerprint() {
+			return
+		}
+	}
+	fmt.Printf("Your key %s is not listed in trusted_signers, the signers file is only trusted by those who pin it\n", c.Fingerprint())
+}
+
+// signingCrypt returns a crypt signing with the private key of the user, e.g.
+// to sign the signers file.
+func (a *App) signingCrypt(cfg config) (Crypt, error) {
+	c, err := a.newCrypt(cfg)
+	if err != nil {
+		return c, err
+	}
+	if a.cfg.breakGlass {
+		return c, fmt.Errorf("the private key is required to sign, which is not available with --break-glass")
+	}
+	pw, err := a.passphrase(cfg)
+	if err != nil {
+		return c, err
+	}
+	return c, a.sign(&c, pw.Bytes())
+}
+
+// sign makes c sign the entries it writes. In break-glass mode entries are
+// left unsigned since the private key is not available.
+func (a *App) sign(c *Crypt, pass []byte) error {
+	if a.cfg.breakGlass {
+		return nil
+	}
+	return c.UseSigner(pass)
+}
+
+// passphrase prompts for the passphrase of the private key unless the key is
+// held by the ssh-agent or the scum agent or the passphrase is cached in the
+// kernel keyring, or for the break-glass passphrase. It is only asked for
+// once, later calls return the same buffer which is destroyed by the command
+// once done.
+func (a *App) passphrase(cfg config) (*SecretBuffer, error) {
+	if a.pw != nil {
+		return a.pw, nil
+	}
+
+	var pw *SecretBuffer
+	var err error
+	switch {
+	case a.cfg.breakGlass:
+		pw, err = promptPassword("break-glass passphrase", os.Stderr)
+	case cfg.SSHAgent || a.daemonUnlocked:
+		pw = NewSecretBuffer(0)
+	default:
+		pw, err = a.cachedPassphrase(cfg)
+		if err == nil && a.daemon != nil {
+			if err := a.daemon.Unlock(pw.Bytes()); err != nil {
+				fmt.Fprintf(os.Stderr, "could not unlock scum agent: %s\n", err.Error())
+			}
+		}
+	}
+	if err != nil {
+		return pw, err
+	}
+	a.pw = pw
+	return pw, nil
+}
+
+// openManifest decrypts the manifest of a bag hiding the names of its
+// entries, the passphrase is therefore required even to list them.
+func (a *App) openManifest(cfg config, b *Bag, c Crypt) error {
+	if !b.Hidden() {
+		return nil
+	}
+	pw, err := a.passphrase(cfg)
+	if err != nil {
+		return err
+	}
+	return b.OpenManifest(c, pw.Bytes())
+}
+
+// keyringDescription names the passphrase of the private key in the kernel
+// keyring.
+func keyringDescription(cfg config) string {
+	return "scum:" + cfg.PrivateKey
+}
+
+// cachedPassphrase returns the passphrase cached in the kernel keyring if
+// enabled, otherwise it prompts for it. A prompted passphrase is only cached
+// once it proved to decrypt the private key.
+func (a *App) cachedPassphrase(cfg config) (*SecretBuffer, error) {
+	if !cfg.Keyring {
+		return promptPassword(cfg.PrivateKey, os.Stderr)
+	}
+
+	pw, err := keyringGet(keyringDescription(cfg))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read passphrase from keyring: %s\n", err.Error())
+	} else if pw != nil {
+		return pw, nil
+	}
+
+	pw, err = promptPassword(cfg.PrivateKey, os.Stderr)
+	if err != nil {
+		return pw, err
+	}
+	c, err := NewCrypt(cfg.Cipher, cfg.PublicKey, cfg.PrivateKey)
+	if err != nil {
+		return pw, nil
+	}
+	if _, err := c.PrivateKeyFingerprint(pw.Bytes()); err != nil {
+		return pw, nil
+	}
+	if err := keyringSet(keyringDescription(cfg), pw.Bytes(), cfg.KeyringTTL); err != nil {
+		fmt.Fprintf(os.Stderr, "could not cache passphrase in keyring: %s\n", err.Error())
+	}
+	return pw, nil
+}
+
+// updateMeta applies update to the metadata of an entry and writes it, either
+// plain or encrypted with ec as configured. Missing metadata is started
+// afresh, metadata which cannot be read is left alone.
+func (a *App) updateMeta(cfg config, b Bag, ec Crypt, name, kind string, pass []byte, update func(*Metadata)) error {
+	m := Metadata{}
+	data, err := b.ReadMeta(name, kind)
+	if err == nil {
+		m, err = decodeMeta(ec, data, name, kind, pass)
+		if err != nil {
+			return fmt.Errorf("metadata of '%s' could not be read: %s", name, err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	update(&m)
+
+	data, err = encodeMeta(ec, m, name, kind, cfg.Metadata == metadataPlain)
+	if err != nil {
+		return err
+	}
+	return b.WriteMeta(name, kind, data)
+}
+
+// describe applies the description and owner given on the command line.
+func (a *App) describe(m *Metadata) {
+	if a.cfg.description != "" {
+		m.Description = a.cfg.description
+	}
+	if a.cfg.owner != "" {
+		m.Owner = a.cfg.owner
+	}
+}
+
+// defaultOwner names the user adding an entry by the comment of their public
+// key, or by its fingerprint if it has none.
+func defaultOwner(cfg config, c Crypt) string {
+	data, err := ioutil.ReadFile(cfg.PublicKey)
+	if err == nil {
+		if rs, err := parseRecipients(data); err == nil && len(rs) > 0 && rs[0].Comment != "" {
+			return rs[0].Comment
+		}
+	}
+	return c.Fingerprint()
+}
+
+// patternsOrSelector requires the entries to be selected by name patterns,
+// a selector or both.
+func (a *App) patternsOrSelector(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && a.cfg.selector == "" {
+		return fmt.Errorf("requires at least 1 name pattern or a selector (-l)")
+	}
+	return nil
+}
+
+// selectEntries keeps the entries of list whose tags match the selector given
+// with -l. The passphrase is only asked for if encrypted metadata is read.
+func (a *App) selectEntries(cfg config, b Bag, c Crypt, list map[string]string) (map[string]string, error) {
+	if a.cfg.selector == "" {
+		return list, nil
+	}
+	sel, err := parseSelector(a.cfg.selector)
+	if err != nil {
+		return nil, err
+	}
+
+	names := sortedNames(list)
+	metas := make([][]byte, len(names))
+	var pass []byte
+	for i, name := range names {
+		data, err := b.ReadMeta(name, list[name])
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		metas[i] = data
+		if pass == nil && !metaIsPlain(data) {
+			pw, err := a.passphrase(cfg)
+			if err != nil {
+				return nil, err
+			}
+			pass = pw.Bytes()
+		}
+	}
+
+	matched := make([]bool, len(names))
+	errs := make([]error, len(names))
+	parallel(len(names), cfg.Workers, func(i int) {
+		m := Metadata{}
+		if metas[i] != nil {
+			m, errs[i] = decodeMeta(c, metas[i], names[i], list[names[i]], pass)
+		}
+		matched[i] = sel.matches(m.Tags)
+	})
+
+	out := map[string]string{}
+	for i, name := range names {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("metadata of '%s' could not be read: %s", name, errs[i].Error())
+		}
+		if matched[i] {
+			out[name] = list[name]
+		}
+	}
+	return out, nil
+}
+
+// keyComments maps the fingerprints of the recipients and signers of the bag
+// to the comments of their keys.
+func keyComments(b Bag) (map[string]string, error) {
+	comments := map[string]string{}
+	rs, err := b.Recipients()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rs {
+		comments[r.Fingerprint()] = r.Comment
+	}
+
+	ss, err := b.Signers()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		if s.Comment != "" {
+			comments[s.Fingerprint()] = s.Comment
+		}
+	}
+	return comments, nil
+}
+
+// signerName names the signer of an encrypted entry by the comment of its key
+// if known, the signature itself is not verified.
+func signerName(encrypted []byte, comments map[string]string) string {
+	key, err := signerOf(encrypted)
+	if err != nil {
+		return "invalid signature"
+	} else if key == nil {
+		return "nobody"
+	}
+	signer := ssh.FingerprintSHA256(key)
+	if comment, ok := comments[signer]; ok && comment != "" {
+		signer = comment
+	}
+	return signer
+}
+
+// singleEntry picks the entry named pattern from the entries matching it, or
+// the only matching entry.
+func singleEntry(list map[string]string, pattern string) (string, string, error) {
+	if kind, ok := list[pattern]; ok {
+		return pattern, kind, nil
+	}
+	switch len(list) {
+	case 0:
+		return "", "", fmt.Errorf("no entry matches '%s'", pattern)
+	case 1:
+		for name, kind := range list {
+			return name, kind, nil
+		}
+	}
+	return "", "", fmt.Errorf("'%s' matches %d entries: %s", pattern, len(list), strings.Join(sortedNames(list), ", "))
+}
+
+// findRevision looks up the revision rev of an entry, as given on the command
+// line.
+func findRevision(b Bag, name, kind, rev string) (Revision, error) {
+	n, err := strconv.Atoi(rev)
+	if err != nil {
+		return Revision{}, fmt.Errorf("invalid revision '%s'", rev)
+	}
+	revs, err := b.History(name, kind)
+	if err != nil {
+		return Revision{}, err
+	}
+	for _, r := range revs {
+		if r.Rev == n {
+			return r, nil
+		}
+	}
+	return Revision{}, fmt.Errorf("revision %d of '%s' is not kept, see 'scum history %s'", n, name, name)
+}
+
+// readProfile decrypts the entry name of type kind.
+func readProfile(b Bag, c Crypt, name, kind string, pass []byte) (Profile, error) {
+	p, err := NewProfile(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := b.Read(name, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.Decrypt(encrypted, entryAssociatedData(name, kind), pass)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Destroy()
+
+	err = p.Deserialize(data)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 func (a *App) typesCmd(cmd *cobra.Command, args []string) {
 	for _, name := range ptr.List() {
 		d, err := ptr.Describe(name)
@@ -130,6 +808,15 @@ func (a *App) typesCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+func (a *App) ciphersCmd(cmd *cobra.Command, args []string) {
+	for _, name := range cr.List() {
+		d, err := cr.Describe(name)
+		exitOnErr(err)
+		fmt.Printf("Cipher \033[1m'%s'\033[0m\n\n", name)
+		fmt.Printf("%s\n\n", d)
+	}
+}
+
 func (a *App) configCmd(cmd *cobra.Command, args []string) {
 	cfg, err := NewConfig(a.cfg.configPath)
 	exitOnErr(err)
@@ -143,42 +830,157 @@ func (a *App) addCmd(cmd *cobra.Command, args []string) {
 	cfg, err := NewConfig(a.cfg.configPath)
 	exitOnErr(err)
 
-	c, err := NewCrypt(cfg.PublicRSAKey, cfg.PrivateRSAKey)
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+
+	acl, err := b.ACL()
 	exitOnErr(err)
 
 	p, err := NewProfile(a.cfg.flagKind)
 	exitOnErr(err)
 
+	// the private key is required to sign the entry
+	var pass []byte
+	if !a.cfg.breakGlass {
+		pw, err := a.passphrase(cfg)
+		exitOnErr(err)
+		defer pw.Destroy()
+		err = a.sign(&c, pw.Bytes())
+		exitOnErr(err)
+		pass = pw.Bytes()
+	}
+
+	err = a.openManifest(cfg, &b, c)
+	exitOnErr(err)
+
 	p.Prompt()
+	err = checkEntryName(p.Name())
+	exitOnErr(err)
 	serialized, err := p.Serialize()
 	exitOnErr(err)
+	defer wipe(serialized)
 
-	encrypted, err := c.Encrypt(serialized)
+	ec, err := acl.Restrict(c, rs, p.Name())
 	exitOnErr(err)
 
-	b, err := NewBag(cfg.BagPath)
+	encrypted, err := ec.Encrypt(serialized, entryAssociatedData(p.Name(), p.Type()))
 	exitOnErr(err)
 
 	err = b.Write(p.Name(), p.Type(), encrypted)
 	exitOnErr(err)
+
+	// adding an existing entry again keeps its creation date
+	err = a.updateMeta(cfg, b, ec, p.Name(), p.Type(), pass, func(m *Metadata) {
+		now := metaNow()
+		if m.Created.IsZero() {
+			m.Created = now
+		}
+		m.Updated = now
+		if m.Owner == "" {
+			m.Owner = defaultOwner(cfg, c)
+		}
+		a.describe(m)
+	})
+	exitOnErr(err)
+
+	err = b.WriteManifest(c)
+	exitOnErr(err)
 }
 
 func (a *App) listCmd(cmd *cobra.Command, args []string) {
 	cfg, err := NewConfig(a.cfg.configPath)
 	exitOnErr(err)
 
-	b, err := NewBag(cfg.BagPath)
+	b, err := a.newBag(cfg)
 	exitOnErr(err)
 
+	// the passphrase is only needed for a bag hiding the names of its entries
+	// or to show or select by encrypted metadata
+	var c Crypt
+	var pass []byte
+	if b.Hidden() || a.cfg.showMeta || a.cfg.selector != "" {
+		c, err = a.newCrypt(cfg)
+		exitOnErr(err)
+		defer func() { a.pw.Destroy() }()
+		err = a.trustSigners(cfg, b, &c)
+		exitOnErr(err)
+		err = a.openManifest(cfg, &b, c)
+		exitOnErr(err)
+	}
+	if a.cfg.showMeta {
+		pw, err := a.passphrase(cfg)
+		exitOnErr(err)
+		pass = pw.Bytes()
+	}
+
 	list, err := b.List(args)
 	exitOnErr(err)
+	list, err = a.selectEntries(cfg, b, c, list)
+	exitOnErr(err)
+
+	comments, err := keyComments(b)
+	exitOnErr(err)
 
 	if len(list) == 0 {
 		fmt.Println("No matches found")
 	}
 
-	for name, kind := range list {
-		fmt.Printf("%s (type %s)\n", name, kind)
+	// entries in folders are shown as a tree below their folders, the names
+	// sorted alphabetically keep the entries of a folder together
+	shown := []string{}
+	for _, name := range sortedNames(list) {
+		kind := list[name]
+		encrypted, err := b.Read(name, kind)
+		exitOnErr(err)
+
+		dirs, base := folders(name)
+		same := 0
+		for same < len(dirs) && same < len(shown) && dirs[same] == shown[same] {
+			same++
+		}
+		for i := same; i < len(dirs); i++ {
+			fmt.Printf("%s%s/\n", strings.Repeat("  ", i), dirs[i])
+		}
+		shown = dirs
+		indent := strings.Repeat("  ", len(dirs))
+
+		readers := []string{}
+		for _, fp := range readersOf(encrypted) {
+			if comment, ok := comments[fp]; ok && comment != "" {
+				fp = comment
+			}
+			readers = append(readers, fp)
+		}
+		if len(readers) == 0 {
+			readers = append(readers, "unknown")
+		}
+
+		signer := signerName(encrypted, comments)
+
+		fmt.Printf("%s%s (type %s), readable by: %s, signed by: %s\n", indent, base, kind, strings.Join(readers, ", "), signer)
+
+		data, err := b.ReadMeta(name, kind)
+		if os.IsNotExist(err) || (err == nil && !metaIsPlain(data) && !a.cfg.showMeta) {
+			continue
+		}
+		var m Metadata
+		if err == nil {
+			m, err = decodeMeta(c, data, name, kind, pass)
+		}
+		if err != nil {
+			fmt.Printf("%s\tmetadata could not be read: %s\n", indent, err.Error())
+		} else if s := m.String(); s != "" {
+			fmt.Printf("%s\t%s\n", indent, s)
+		}
 	}
 }
 
@@ -186,84 +988,127 @@ func (a *App) showCmd(cmd *cobra.Command, args []string) {
 	cfg, err := NewConfig(a.cfg.configPath)
 	exitOnErr(err)
 
-	c, err := NewCrypt(cfg.PublicRSAKey, cfg.PrivateRSAKey)
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
 	exitOnErr(err)
 
-	b, err := NewBag(cfg.BagPath)
+	err = a.trustSigners(cfg, b, &c)
+	exitOnErr(err)
+
+	err = a.openManifest(cfg, &b, c)
 	exitOnErr(err)
 
 	list, err := b.List(args)
 	exitOnErr(err)
+	list, err = a.selectEntries(cfg, b, c, list)
+	exitOnErr(err)
 
-	var pw []byte
+	var pw *SecretBuffer
 	if len(list) > 0 {
-		pw, err = promptPassword(cfg.PrivateRSAKey, os.Stderr)
+		pw, err = a.passphrase(cfg)
 		exitOnErr(err)
+		defer pw.Destroy()
 	} else {
 		fmt.Println("No matches found")
 		return
 	}
 
-	for name, kind := range list {
-		p, err := NewProfile(kind)
-		exitOnErr(err)
-
-		encrypted, err := b.Read(name, kind)
-		exitOnErr(err)
+	names := sortedNames(list)
+	profiles := make([]Profile, len(names))
+	errs := make([]error, len(names))
+	parallel(len(names), cfg.Workers, func(i int) {
+		profiles[i], errs[i] = readProfile(b, c, names[i], list[names[i]], pw.Bytes())
+	})
 
-		data, err := c.Decrypt(encrypted, pw)
-		exitOnErr(err)
-
-		err = p.Deserialize(data)
-		exitOnErr(err)
-
-		fmt.Println(p)
-	}
-}
+	for i := range names {
+		exitOnErr(errs[i])
+		fmt.Println(profiles[i])
+	}
+}
 
 func (a *App) editCmd(cmd *cobra.Command, args []string) {
 	cfg, err := NewConfig(a.cfg.configPath)
 	exitOnErr(err)
 
-	c, err := NewCrypt(cfg.PublicRSAKey, cfg.PrivateRSAKey)
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	err = a.trustSigners(cfg, b, &c)
+	exitOnErr(err)
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+
+	acl, err := b.ACL()
 	exitOnErr(err)
 
-	b, err := NewBag(cfg.BagPath)
+	err = a.openManifest(cfg, &b, c)
 	exitOnErr(err)
 
 	list, err := b.List(args)
 	exitOnErr(err)
+	list, err = a.selectEntries(cfg, b, c, list)
+	exitOnErr(err)
 
-	var pw []byte
+	var pw *SecretBuffer
 	if len(list) > 0 {
-		pw, err = promptPassword(cfg.PrivateRSAKey, os.Stderr)
+		pw, err = a.passphrase(cfg)
+		exitOnErr(err)
+		defer pw.Destroy()
+		err = a.sign(&c, pw.Bytes())
 		exitOnErr(err)
 	} else {
 		fmt.Println("No matches found")
 		return
 	}
 
-	for name, kind := range list {
+	for _, name := range sortedNames(list) {
+		kind := list[name]
 		encrypted, err := b.Read(name, kind)
 		exitOnErr(err)
 
-		data, err := c.Decrypt(encrypted, pw)
+		data, err := c.Decrypt(encrypted, entryAssociatedData(name, kind), pw.Bytes())
+		exitOnErr(err)
+
+		edited, err := CaptureInputFromEditor(data.Bytes())
 		exitOnErr(err)
 
-		edited, err := CaptureInputFromEditor(data)
+		unchanged := bytes.Equal(data.Bytes(), edited)
+		data.Destroy()
+
+		ec, err := acl.Restrict(c, rs, name)
 		exitOnErr(err)
 
-		if bytes.Equal(data, edited) {
+		if unchanged {
+			if a.cfg.description != "" || a.cfg.owner != "" {
+				err = a.updateMeta(cfg, b, ec, name, kind, pw.Bytes(), a.describe)
+				exitOnErr(err)
+			}
 			fmt.Printf("nothing changed, done!\n")
 			continue
 		}
 
-		newEncrypted, err := c.Encrypt(edited)
+		newEncrypted, err := ec.Encrypt(edited, entryAssociatedData(name, kind))
+		wipe(edited)
 		exitOnErr(err)
 
 		err = b.Write(name, kind, newEncrypted)
 		exitOnErr(err)
 
+		err = a.updateMeta(cfg, b, ec, name, kind, pw.Bytes(), func(m *Metadata) {
+			m.Updated = metaNow()
+			a.describe(m)
+		})
+		exitOnErr(err)
+
 		fmt.Printf("done!\n")
 	}
 }
@@ -272,46 +1117,59 @@ func (a *App) mountCmd(cmd *cobra.Command, args []string) {
 	cfg, err := NewConfig(a.cfg.configPath)
 	exitOnErr(err)
 
-	c, err := NewCrypt(cfg.PublicRSAKey, cfg.PrivateRSAKey)
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	err = a.trustSigners(cfg, b, &c)
 	exitOnErr(err)
 
-	b, err := NewBag(cfg.BagPath)
+	err = a.openManifest(cfg, &b, c)
 	exitOnErr(err)
 
 	list, err := b.List(args)
 	exitOnErr(err)
+	list, err = a.selectEntries(cfg, b, c, list)
+	exitOnErr(err)
 
-	var pw []byte
+	var pw *SecretBuffer
 	if len(list) > 0 {
-		pw, err = promptPassword(cfg.PrivateRSAKey, os.Stderr)
+		pw, err = a.passphrase(cfg)
 		exitOnErr(err)
+		defer pw.Destroy()
 	} else {
 		fmt.Println("No matches found")
 		return
 	}
 
-	mountFiles := map[string][]byte{}
-	for name, kind := range list {
-		p, err := NewProfile(kind)
-		exitOnErr(err)
-
-		if !p.Capabilities().Mount {
-			fmt.Printf("Profile '%s' cannot be mounted because its of kind %s which does not support mount. Skipping...\n", name, kind)
-			continue
+	names := sortedNames(list)
+	profiles := make([]Profile, len(names))
+	errs := make([]error, len(names))
+	parallel(len(names), cfg.Workers, func(i int) {
+		p, err := NewProfile(list[names[i]])
+		if err != nil || !p.Capabilities().Mount {
+			errs[i] = err
+			return
 		}
+		profiles[i], errs[i] = readProfile(b, c, names[i], list[names[i]], pw.Bytes())
+	})
 
-		encrypted, err := b.Read(name, kind)
-		exitOnErr(err)
-
-		data, err := c.Decrypt(encrypted, pw)
-		exitOnErr(err)
+	mountFiles := map[string]*SecretBuffer{}
+	for i, name := range names {
+		exitOnErr(errs[i])
 
-		err = p.Deserialize(data)
-		exitOnErr(err)
+		p := profiles[i]
+		if p == nil {
+			fmt.Printf("Profile '%s' cannot be mounted because its of kind %s which does not support mount. Skipping...\n", name, list[name])
+			continue
+		}
 
 		mountPath, mountSnippet := p.MountSnippet()
-		mountData := append(mountFiles[mountPath], []byte(mountSnippet)...)
-		mountFiles[mountPath] = mountData
+		snippet := []byte(mountSnippet)
+		mountFiles[mountPath] = mountFiles[mountPath].Append(snippet)
+		wipe(snippet)
 	}
 
 	fmt.Printf("Mounting credentials at %s\n", cfg.Mountpoint)
@@ -322,50 +1180,95 @@ func (a *App) verifyCmd(cmd *cobra.Command, args []string) {
 	cfg, err := NewConfig(a.cfg.configPath)
 	exitOnErr(err)
 
-	c, err := NewCrypt(cfg.PublicRSAKey, cfg.PrivateRSAKey)
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	err = a.trustSigners(cfg, b, &c)
+	exitOnErr(err)
+
+	// the metadata of verified entries is encrypted for their readers
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+
+	acl, err := b.ACL()
 	exitOnErr(err)
 
-	b, err := NewBag(cfg.BagPath)
+	err = a.openManifest(cfg, &b, c)
 	exitOnErr(err)
 
 	list, err := b.List(args)
 	exitOnErr(err)
+	list, err = a.selectEntries(cfg, b, c, list)
+	exitOnErr(err)
 
-	var pw []byte
+	var pw *SecretBuffer
 	if len(list) > 0 {
-		pw, err = promptPassword(cfg.PrivateRSAKey, os.Stderr)
+		pw, err = a.passphrase(cfg)
+		exitOnErr(err)
+		defer pw.Destroy()
+		err = a.sign(&c, pw.Bytes())
 		exitOnErr(err)
 	} else {
 		fmt.Println("No matches found")
 		return
 	}
 
-	for name, kind := range list {
+	getUnicode := func(b bool) string {
+		if b {
+			return "✔"
+		}
+		return "✘"
+	}
+
+	// the credentials are verified by the workers as well, as this is what
+	// takes the most time
+	names := sortedNames(list)
+	results := make([]string, len(names))
+	errs := make([]error, len(names))
+	parallel(len(names), cfg.Workers, func(i int) {
+		name, kind := names[i], list[names[i]]
 		p, err := NewProfile(kind)
-		exitOnErr(err)
+		if err != nil {
+			errs[i] = err
+			return
+		}
 
 		if !p.Capabilities().Verify {
-			fmt.Printf("Profile '%s' cannot be verified because its of kind %s which does not support verification. Skipping...\n", name, kind)
-			continue
+			results[i] = fmt.Sprintf("Profile '%s' cannot be verified because its of kind %s which does not support verification. Skipping...\n", name, kind)
+			return
 		}
 
-		encrypted, err := b.Read(name, kind)
-		exitOnErr(err)
-
-		data, err := c.Decrypt(encrypted, pw)
-		exitOnErr(err)
+		p, err = readProfile(b, c, name, kind, pw.Bytes())
+		if err != nil {
+			errs[i] = err
+			return
+		}
 
-		err = p.Deserialize(data)
-		exitOnErr(err)
+		out, ok := p.VerifyCredentials()
+		results[i] = fmt.Sprintf("%s\t%s (type %s), message: %s\n", getUnicode(ok), p.Name(), p.Type(), out)
+		if !ok {
+			return
+		}
 
-		getUnicode := func(b bool) string {
-			if b {
-				return "✔"
-			}
-			return "✘"
+		ec, err := acl.Restrict(c, rs, name)
+		if err != nil {
+			errs[i] = err
+			return
 		}
-		out, ok := p.VerifyCredentials()
-		fmt.Printf("%s\t%s (type %s), message: %s\n", getUnicode(ok), p.Name(), p.Type(), out)
+		errs[i] = a.updateMeta(cfg, b, ec, name, kind, pw.Bytes(), func(m *Metadata) {
+			m.VerifiedAt = metaNow()
+		})
+	})
+
+	for i := range names {
+		exitOnErr(errs[i])
+		fmt.Print(results[i])
 	}
 }
 
@@ -373,60 +1276,1446 @@ func (a *App) rotateCmd(cmd *cobra.Command, args []string) {
 	cfg, err := NewConfig(a.cfg.configPath)
 	exitOnErr(err)
 
-	c, err := NewCrypt(cfg.PublicRSAKey, cfg.PrivateRSAKey)
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	err = a.trustSigners(cfg, b, &c)
 	exitOnErr(err)
 
-	b, err := NewBag(cfg.BagPath)
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+
+	acl, err := b.ACL()
+	exitOnErr(err)
+
+	err = a.openManifest(cfg, &b, c)
 	exitOnErr(err)
 
 	list, err := b.List(args)
 	exitOnErr(err)
+	list, err = a.selectEntries(cfg, b, c, list)
+	exitOnErr(err)
 
-	var pw []byte
+	var pw *SecretBuffer
 	if len(list) > 0 {
 		fmt.Printf("The following credentials are going to be rotated:\n")
-		for name, kind := range list {
-			fmt.Printf("\t%s (type %s)\n", name, kind)
+		for _, name := range sortedNames(list) {
+			fmt.Printf("\t%s (type %s)\n", name, list[name])
 		}
-		pw, err = promptPassword(cfg.PrivateRSAKey, os.Stderr)
+		pw, err = a.passphrase(cfg)
+		exitOnErr(err)
+		defer pw.Destroy()
+		err = a.sign(&c, pw.Bytes())
 		exitOnErr(err)
 	} else {
 		fmt.Println("No matches found")
 		return
 	}
 
-	for name, kind := range list {
-		p, err := NewProfile(kind)
-		exitOnErr(err)
+	// all entries are decrypted before the first one is rotated, the
+	// rotations themselves run one after another
+	names := sortedNames(list)
+	profiles := make([]Profile, len(names))
+	errs := make([]error, len(names))
+	parallel(len(names), cfg.Workers, func(i int) {
+		p, err := NewProfile(list[names[i]])
+		if err != nil || !p.Capabilities().Rotate {
+			errs[i] = err
+			return
+		}
+		profiles[i], errs[i] = readProfile(b, c, names[i], list[names[i]], pw.Bytes())
+	})
+	for i := range names {
+		exitOnErr(errs[i])
+	}
 
-		if !p.Capabilities().Rotate {
-			fmt.Printf("Profile '%s' cannot be rotated because its of kind %s which does not support key rotation. Skipping...\n", name, kind)
+	for i, name := range names {
+		p := profiles[i]
+		if p == nil {
+			fmt.Printf("Profile '%s' cannot be rotated because its of kind %s which does not support key rotation. Skipping...\n", name, list[name])
 			continue
 		}
 		fmt.Printf("Rotating %s (type %s)... ", name, p.Type())
 
-		encrypted, err := b.Read(name, kind)
+		ec, err := acl.Restrict(c, rs, name)
 		exitOnErr(err)
 
-		data, err := c.Decrypt(encrypted, pw)
+		newSerialized, err := p.RotateCredentials()
 		exitOnErr(err)
 
-		err = p.Deserialize(data)
+		newEncrypted, err := ec.Encrypt(newSerialized, entryAssociatedData(p.Name(), p.Type()))
+		wipe(newSerialized)
 		exitOnErr(err)
 
-		newSerialized, err := p.RotateCredentials()
+		err = b.Write(p.Name(), p.Type(), newEncrypted)
 		exitOnErr(err)
 
-		newEncrypted, err := c.Encrypt(newSerialized)
+		err = a.updateMeta(cfg, b, ec, p.Name(), p.Type(), pw.Bytes(), func(m *Metadata) {
+			m.RotatedAt = metaNow()
+			m.Updated = m.RotatedAt
+		})
 		exitOnErr(err)
 
-		err = b.Write(p.Name(), p.Type(), newEncrypted)
+		fmt.Printf("done!\n")
+	}
+}
+
+func (a *App) tagCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	set, remove, err := parseTagChanges(args[1:])
+	exitOnErr(err)
+
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	err = a.trustSigners(cfg, b, &c)
+	exitOnErr(err)
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+
+	acl, err := b.ACL()
+	exitOnErr(err)
+
+	err = a.openManifest(cfg, &b, c)
+	exitOnErr(err)
+
+	list, err := b.List(args[:1])
+	exitOnErr(err)
+
+	// the passphrase is required to read the existing metadata and to sign
+	// it, even if it is not encrypted anymore
+	var pw *SecretBuffer
+	if len(list) > 0 {
+		pw, err = a.passphrase(cfg)
+		exitOnErr(err)
+		defer pw.Destroy()
+		err = a.sign(&c, pw.Bytes())
+		exitOnErr(err)
+	} else {
+		fmt.Println("No matches found")
+		return
+	}
+
+	for _, name := range sortedNames(list) {
+		kind := list[name]
+		ec, err := acl.Restrict(c, rs, name)
 		exitOnErr(err)
 
-		fmt.Printf("done!\n")
+		// without changes the tags are only shown
+		if len(set) == 0 && len(remove) == 0 {
+			m := Metadata{}
+			data, err := b.ReadMeta(name, kind)
+			if err == nil {
+				m, err = decodeMeta(c, data, name, kind, pw.Bytes())
+			}
+			if err != nil && !os.IsNotExist(err) {
+				exitOnErr(err)
+			}
+			fmt.Printf("%s (type %s), tags: %s\n", name, kind, formatTags(m.Tags))
+			continue
+		}
+
+		tags := ""
+		err = a.updateMeta(cfg, b, ec, name, kind, pw.Bytes(), func(m *Metadata) {
+			if m.Tags == nil {
+				m.Tags = map[string]string{}
+			}
+			for key, value := range set {
+				m.Tags[key] = value
+			}
+			for _, key := range remove {
+				delete(m.Tags, key)
+			}
+			tags = formatTags(m.Tags)
+		})
+		exitOnErr(err)
+
+		fmt.Printf("%s (type %s), tags: %s\n", name, kind, tags)
 	}
 }
 
-func (a *App) versionCmd(cmd *cobra.Command, args []string) {
-	fmt.Println(versionInfo())
+func (a *App) historyCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	if b.Hidden() {
+		c, err := a.newCrypt(cfg)
+		exitOnErr(err)
+		err = a.trustSigners(cfg, b, &c)
+		exitOnErr(err)
+		err = a.openManifest(cfg, &b, c)
+		exitOnErr(err)
+		defer func() { a.pw.Destroy() }()
+	}
+
+	list, err := b.List(args)
+	exitOnErr(err)
+	name, kind, err := singleEntry(list, args[0])
+	exitOnErr(err)
+
+	comments, err := keyComments(b)
+	exitOnErr(err)
+
+	revs, err := b.History(name, kind)
+	exitOnErr(err)
+	if len(revs) == 0 {
+		fmt.Printf("No previous revisions of %s (type %s) are kept\n", name, kind)
+	}
+	for _, r := range revs {
+		encrypted, err := b.ReadRevision(r)
+		exitOnErr(err)
+		fmt.Printf("revision %d, written %s, signed by: %s\n", r.Rev, r.Written.Local().Format("2006-01-02 15:04:05"), signerName(encrypted, comments))
+	}
+
+	info, err := b.Stat(name, kind)
+	exitOnErr(err)
+	encrypted, err := b.Read(name, kind)
+	exitOnErr(err)
+	fmt.Printf("current, written %s, signed by: %s\n", info.ModTime.Local().Format("2006-01-02 15:04:05"), signerName(encrypted, comments))
+}
+
+func (a *App) rollbackCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	err = a.trustSigners(cfg, b, &c)
+	exitOnErr(err)
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+
+	acl, err := b.ACL()
+	exitOnErr(err)
+
+	err = a.openManifest(cfg, &b, c)
+	exitOnErr(err)
+
+	list, err := b.List(args[:1])
+	exitOnErr(err)
+	name, kind, err := singleEntry(list, args[0])
+	exitOnErr(err)
+	r, err := findRevision(b, name, kind, args[1])
+	exitOnErr(err)
+
+	pw, err := a.passphrase(cfg)
+	exitOnErr(err)
+	defer pw.Destroy()
+	err = a.sign(&c, pw.Bytes())
+	exitOnErr(err)
+
+	// the revision is re-encrypted for the current recipients, it may have
+	// been written for others
+	old, err := b.ReadRevision(r)
+	exitOnErr(err)
+	data, err := c.Decrypt(old, entryAssociatedData(name, kind), pw.Bytes())
+	exitOnErr(err)
+	defer data.Destroy()
+
+	ec, err := acl.Restrict(c, rs, name)
+	exitOnErr(err)
+	encrypted, err := ec.Encrypt(data.Bytes(), entryAssociatedData(name, kind))
+	exitOnErr(err)
+
+	err = b.Write(name, kind, encrypted)
+	exitOnErr(err)
+
+	err = a.updateMeta(cfg, b, ec, name, kind, pw.Bytes(), func(m *Metadata) {
+		m.Updated = metaNow()
+	})
+	exitOnErr(err)
+
+	fmt.Printf("%s (type %s) was rolled back to revision %d\n", name, kind, r.Rev)
+	if cfg.History == 0 {
+		fmt.Printf("The replaced content was not kept since 'history' is 0\n")
+	}
+}
+
+func (a *App) diffCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	err = a.trustSigners(cfg, b, &c)
+	exitOnErr(err)
+
+	err = a.openManifest(cfg, &b, c)
+	exitOnErr(err)
+
+	list, err := b.List(args[:1])
+	exitOnErr(err)
+	name, kind, err := singleEntry(list, args[0])
+	exitOnErr(err)
+	r, err := findRevision(b, name, kind, args[1])
+	exitOnErr(err)
+
+	pw, err := a.passphrase(cfg)
+	exitOnErr(err)
+	defer pw.Destroy()
+
+	fields := func(encrypted []byte) map[string]string {
+		data, err := c.Decrypt(encrypted, entryAssociatedData(name, kind), pw.Bytes())
+		exitOnErr(err)
+		defer data.Destroy()
+		f, err := profileFields(data.Bytes())
+		exitOnErr(err)
+		return f
+	}
+
+	old, err := b.ReadRevision(r)
+	exitOnErr(err)
+	current, err := b.Read(name, kind)
+	exitOnErr(err)
+	before, after := fields(old), fields(current)
+
+	keys := map[string]string{}
+	for key := range before {
+		keys[key] = ""
+	}
+	for key := range after {
+		keys[key] = ""
+	}
+
+	fmt.Printf("--- %s (type %s), revision %d\n+++ %s (type %s), current\n", name, kind, r.Rev, name, kind)
+	changed := false
+	for _, key := range sortedNames(keys) {
+		oldValue, inBefore := before[key]
+		newValue, inAfter := after[key]
+		if inBefore && inAfter && oldValue == newValue {
+			continue
+		}
+		changed = true
+		if inBefore {
+			fmt.Printf("- %s: %s\n", key, oldValue)
+		}
+		if inAfter {
+			fmt.Printf("+ %s: %s\n", key, newValue)
+		}
+	}
+	if !changed {
+		fmt.Println("No differences")
+	}
+}
+
+func (a *App) recipientsListCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+
+	fmt.Printf("%s\t(you, %s)\n", c.Fingerprint(), cfg.PublicKey)
+	for _, r := range rs {
+		if r.Fingerprint() == c.Fingerprint() {
+			continue
+		}
+		fmt.Printf("%s\t%s\n", r.Fingerprint(), r.Comment)
+	}
+}
+
+func (a *App) recipientsAddCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	data, err := ioutil.ReadFile(args[0])
+	exitOnErr(err)
+
+	added, err := parseRecipients(data)
+	exitOnErr(err)
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+
+	known := map[string]bool{}
+	for _, r := range rs {
+		known[r.Fingerprint()] = true
+	}
+	for _, r := range added {
+		if known[r.Fingerprint()] {
+			fmt.Printf("%s (%s) is already a recipient\n", r.Fingerprint(), r.Comment)
+			continue
+		}
+		known[r.Fingerprint()] = true
+		rs = append(rs, r)
+		fmt.Printf("Adding %s (%s)\n", r.Fingerprint(), r.Comment)
+	}
+
+	err = b.WriteRecipients(rs)
+	exitOnErr(err)
+
+	a.recipientsSyncCmd(cmd, []string{})
+}
+
+func (a *App) recipientsAddPassphraseCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	comment := "break-glass"
+	if len(args) > 0 {
+		comment = args[0]
+	}
+
+	pass, err := promptPassword("new break-glass passphrase", os.Stderr)
+	exitOnErr(err)
+	defer pass.Destroy()
+	if pass.Len() == 0 {
+		exitOnErr(fmt.Errorf("passphrase must not be empty"))
+	}
+	confirm, err := promptPassword("new break-glass passphrase (again)", os.Stderr)
+	exitOnErr(err)
+	defer confirm.Destroy()
+	if !bytes.Equal(pass.Bytes(), confirm.Bytes()) {
+		exitOnErr(fmt.Errorf("passphrases do not match"))
+	}
+
+	r, err := newPassphraseRecipient(pass.Bytes())
+	exitOnErr(err)
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	rs = append(rs, bagRecipient{recipient: r, Comment: comment, Line: r.String() + " " + comment})
+	fmt.Printf("Adding %s (%s)\n", r.Fingerprint(), comment)
+
+	err = b.WriteRecipients(rs)
+	exitOnErr(err)
+
+	a.recipientsSyncCmd(cmd, []string{})
+}
+
+func (a *App) recipientsRemoveCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+
+	remove := map[string]bool{}
+	for _, fp := range args {
+		remove[fp] = true
+	}
+
+	kept := []bagRecipient{}
+	for _, r := range rs {
+		if remove[r.Fingerprint()] {
+			fmt.Printf("Removing %s (%s)\n", r.Fingerprint(), r.Comment)
+			delete(remove, r.Fingerprint())
+			continue
+		}
+		kept = append(kept, r)
+	}
+	for fp := range remove {
+		exitOnErr(fmt.Errorf("%s is not a recipient of scum bag '%s'", fp, b.Base))
+	}
+
+	err = b.WriteRecipients(kept)
+	exitOnErr(err)
+
+	a.recipientsSyncCmd(cmd, []string{})
+}
+
+func (a *App) recipientsSyncCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+	// entries of older versions are upgraded, see syncEntries
+	c.UseLegacyPolicy(legacyUpgrade)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	err = a.trustSigners(cfg, b, &c)
+	exitOnErr(err)
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+
+	acl, err := b.ACL()
+	exitOnErr(err)
+
+	err = a.openManifest(cfg, &b, c)
+	exitOnErr(err)
+
+	a.syncEntries(cfg, b, c, rs, acl, func() (*SecretBuffer, error) { return a.passphrase(cfg) })
+}
+
+// syncEntries re-encrypts all entries of the bag, their revisions and
+// metadata and its manifest, which are not encrypted for the current
+// recipients, pass is only called if there is anything to do. Metadata is
+// also converted if the option 'metadata' of the configuration changed.
+func (a *App) syncEntries(cfg config, b Bag, c Crypt, rs []bagRecipient, acl ACL, pass func() (*SecretBuffer, error)) {
+	c.UseLegacyPolicy(legacyUpgrade)
+	list, err := b.List([]string{})
+	exitOnErr(err)
+
+	// the manifest is readable by all recipients regardless of the acl
+	manifestCurrent, err := b.ManifestIsCurrent(c)
+	exitOnErr(err)
+
+	// entries already encrypted for the current recipients are skipped, an
+	// interrupted run can therefore simply be started again
+	plain := cfg.Metadata == metadataPlain
+	outdated := map[string]string{}
+	outdatedEntries := map[string]bool{}
+	outdatedRevs := map[string][]Revision{}
+	outdatedMeta := map[string]bool{}
+	for name, kind := range list {
+		ec, err := acl.Restrict(c, rs, name)
+		exitOnErr(err)
+
+		encrypted, err := b.Read(name, kind)
+		exitOnErr(err)
+		if !ec.IsCurrent(encrypted) {
+			outdated[name] = kind
+			outdatedEntries[name] = true
+		}
+
+		// revisions are readable by the same recipients as the entry
+		revs, err := b.History(name, kind)
+		exitOnErr(err)
+		for _, r := range revs {
+			data, err := b.ReadRevision(r)
+			exitOnErr(err)
+			if !ec.IsCurrent(data) {
+				outdated[name] = kind
+				outdatedRevs[name] = append(outdatedRevs[name], r)
+			}
+		}
+
+		meta, err := b.ReadMeta(name, kind)
+		if os.IsNotExist(err) {
+			continue
+		}
+		exitOnErr(err)
+		if metaIsPlain(meta) != plain || (!plain && !ec.IsCurrent(meta)) {
+			outdated[name] = kind
+			outdatedMeta[name] = true
+		}
+	}
+
+	if len(outdated) == 0 && manifestCurrent {
+		fmt.Println("All entries are encrypted for the current recipients")
+		return
+	}
+
+	fmt.Printf("%d of %d entries need to be re-encrypted\n", len(outdated), len(list))
+	pw, err := pass()
+	exitOnErr(err)
+	defer pw.Destroy()
+	err = a.sign(&c, pw.Bytes())
+	exitOnErr(err)
+
+	reencrypt := func(ec Crypt, name, kind string, encrypted []byte) ([]byte, error) {
+		data, err := c.Decrypt(encrypted, entryAssociatedData(name, kind), pw.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		defer data.Destroy()
+		return ec.Encrypt(data.Bytes(), entryAssociatedData(name, kind))
+	}
+
+	// an entry is re-encrypted together with its revisions and its metadata,
+	// a removed recipient must not keep access to any of them
+	syncEntry := func(name, kind string) error {
+		ec, err := acl.Restrict(c, rs, name)
+		if err != nil {
+			return err
+		}
+
+		t, err := b.Begin()
+		if err != nil {
+			return err
+		}
+		err = func() error {
+			if outdatedEntries[name] {
+				encrypted, err := b.Read(name, kind)
+				if err != nil {
+					return err
+				}
+				data, err := reencrypt(ec, name, kind, encrypted)
+				if err != nil {
+					return err
+				}
+				if err := t.Write(name, kind, data); err != nil {
+					return err
+				}
+			}
+			for _, r := range outdatedRevs[name] {
+				encrypted, err := b.ReadRevision(r)
+				if err != nil {
+					return err
+				}
+				data, err := reencrypt(ec, name, kind, encrypted)
+				if err != nil {
+					return fmt.Errorf("revision %d: %s", r.Rev, err.Error())
+				}
+				if err := t.WriteRevision(name, kind, r, data); err != nil {
+					return err
+				}
+			}
+			if outdatedMeta[name] {
+				data, err := b.ReadMeta(name, kind)
+				if err != nil {
+					return err
+				}
+				m, err := decodeMeta(c, data, name, kind, pw.Bytes())
+				if err != nil {
+					return err
+				}
+				data, err = encodeMeta(ec, m, name, kind, plain)
+				if err != nil {
+					return err
+				}
+				if err := t.WriteMeta(name, kind, data); err != nil {
+					return err
+				}
+			}
+			return nil
+		}()
+		if err != nil {
+			t.Rollback()
+			return err
+		}
+		return t.Commit()
+	}
+
+	i, failed := 0, 0
+	for _, name := range sortedNames(outdated) {
+		kind := outdated[name]
+		i++
+		fmt.Printf("[%d/%d] Re-encrypting %s (type %s)... ", i, len(outdated), name, kind)
+		if err := syncEntry(name, kind); err != nil {
+			fmt.Printf("failed: %s\n", err.Error())
+			failed++
+			continue
+		}
+		fmt.Printf("done!\n")
+	}
+
+	if !manifestCurrent {
+		fmt.Printf("Re-encrypting manifest... ")
+		err = b.WriteManifest(c)
+		exitOnErr(err)
+		fmt.Printf("done!\n")
+	}
+
+	if failed > 0 {
+		exitOnErr(fmt.Errorf("%d entries could not be re-encrypted, run 'scum recipients sync' to retry", failed))
+	}
+}
+
+func (a *App) signersListCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	ss, err := b.Signers()
+	exitOnErr(err)
+
+	if ss == nil {
+		fmt.Printf("No signers file\n")
+	}
+	for _, s := range ss {
+		fmt.Printf("%s\t%s\n", s.Fingerprint(), s.Comment)
+	}
+
+	if len(cfg.TrustedSigners) == 0 {
+		fmt.Printf("No keys are pinned with trusted_signers, signatures cannot be verified\n")
+		return
+	}
+	if _, err := b.TrustedSigners(cfg.TrustedSigners); err != nil {
+		fmt.Printf("The signers file is not trusted: %s\n", err.Error())
+		return
+	}
+	fmt.Printf("The signers file is signed by a key pinned with trusted_signers\n")
+}
+
+func (a *App) signersAddCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	data, err := ioutil.ReadFile(args[0])
+	exitOnErr(err)
+
+	added, err := parseSigners(data)
+	exitOnErr(err)
+
+	ss, err := b.Signers()
+	exitOnErr(err)
+
+	known := map[string]bool{}
+	for _, s := range ss {
+		known[s.Fingerprint()] = true
+	}
+	for _, s := range added {
+		if known[s.Fingerprint()] {
+			fmt.Printf("%s (%s) is already a signer\n", s.Fingerprint(), s.Comment)
+			continue
+		}
+		known[s.Fingerprint()] = true
+		ss = append(ss, s)
+		fmt.Printf("Adding %s (%s)\n", s.Fingerprint(), s.Comment)
+	}
+
+	c, err := a.signingCrypt(cfg)
+	exitOnErr(err)
+	defer func() { a.pw.Destroy() }()
+	err = b.WriteSigners(ss, c)
+	exitOnErr(err)
+	a.checkPinned(cfg, c)
+}
+
+func (a *App) signersRemoveCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	ss, err := b.Signers()
+	exitOnErr(err)
+
+	remove := map[string]bool{}
+	for _, fp := range args {
+		remove[fp] = true
+	}
+
+	kept := []bagSigner{}
+	for _, s := range ss {
+		if remove[s.Fingerprint()] {
+			fmt.Printf("Removing %s (%s)\n", s.Fingerprint(), s.Comment)
+			delete(remove, s.Fingerprint())
+			continue
+		}
+		kept = append(kept, s)
+	}
+	for fp := range remove {
+		fmt.Printf("%s is not a signer\n", fp)
+	}
+
+	c, err := a.signingCrypt(cfg)
+	exitOnErr(err)
+	defer func() { a.pw.Destroy() }()
+	err = b.WriteSigners(kept, c)
+	exitOnErr(err)
+	a.checkPinned(cfg, c)
+}
+
+func (a *App) rekeyCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	oldPrivate := tidyPath(a.cfg.oldPrivate)
+	newPublic := tidyPath(a.cfg.newPublic)
+
+	c, err := NewCrypt("", newPublic, oldPrivate)
+	exitOnErr(err)
+	p, err := newPadding(cfg.Padding, cfg.PaddingBlock)
+	exitOnErr(err)
+	c.UsePadding(p)
+	// entries of older versions are re-encrypted for the new key as well
+	c.UseLegacyPolicy(legacyUpgrade)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	data, err := ioutil.ReadFile(newPublic)
+	exitOnErr(err)
+	newKeys, err := parseRecipients(data)
+	exitOnErr(err)
+	newSigners, err := parseSigners(data)
+	exitOnErr(err)
+	if len(newKeys) != 1 {
+		exitOnErr(fmt.Errorf("public key file %s must contain exactly one key", newPublic))
+	}
+
+	pw, err := promptPassword(oldPrivate, os.Stderr)
+	exitOnErr(err)
+	defer pw.Destroy()
+
+	oldFingerprint, err := c.PrivateKeyFingerprint(pw.Bytes())
+	exitOnErr(err)
+
+	// entries are signed with the old key, the private key of the new one is
+	// not needed for rekeying
+	err = a.trustSigners(cfg, b, &c)
+	exitOnErr(err)
+	err = c.UseSigner(pw.Bytes())
+	exitOnErr(err)
+	if b.Hidden() {
+		err = b.OpenManifest(c, pw.Bytes())
+		exitOnErr(err)
+	}
+
+	// the old key is replaced by the new one if it is listed as recipient
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	replaced := false
+	for i, r := range rs {
+		if r.Fingerprint() == oldFingerprint {
+			rs[i] = newKeys[0]
+			replaced = true
+		}
+	}
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+
+	acl, err := b.ACL()
+	exitOnErr(err)
+	acl, aclChanged := acl.ReplaceRecipient(oldFingerprint, c.Fingerprint())
+
+	list, err := b.List([]string{})
+	exitOnErr(err)
+	names := []string{}
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t, err := b.Begin()
+	exitOnErr(err)
+
+	rekey := func(name, kind string) error {
+		encrypted, err := b.Read(name, kind)
+		if err != nil {
+			return err
+		}
+		data, err := c.Decrypt(encrypted, entryAssociatedData(name, kind), pw.Bytes())
+		if err != nil {
+			return err
+		}
+		defer data.Destroy()
+		ec, err := acl.Restrict(c, rs, name)
+		if err != nil {
+			return err
+		}
+		newEncrypted, err := ec.Encrypt(data.Bytes(), entryAssociatedData(name, kind))
+		if err != nil {
+			return err
+		}
+
+		// the revisions and the metadata are converted first, an entry is
+		// either staged with them or not at all
+		revs, err := b.History(name, kind)
+		if err != nil {
+			return err
+		}
+		revData := make([][]byte, len(revs))
+		for i, r := range revs {
+			old, err := b.ReadRevision(r)
+			if err != nil {
+				return err
+			}
+			data, err := c.Decrypt(old, entryAssociatedData(name, kind), pw.Bytes())
+			if err != nil {
+				return fmt.Errorf("revision %d: %s", r.Rev, err.Error())
+			}
+			revData[i], err = ec.Encrypt(data.Bytes(), entryAssociatedData(name, kind))
+			data.Destroy()
+			if err != nil {
+				return err
+			}
+		}
+
+		meta, err := b.ReadMeta(name, kind)
+		if os.IsNotExist(err) {
+			meta = nil
+		} else if err != nil {
+			return err
+		} else {
+			m, err := decodeMeta(c, meta, name, kind, pw.Bytes())
+			if err != nil {
+				return err
+			}
+			meta, err = encodeMeta(ec, m, name, kind, cfg.Metadata == metadataPlain)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := t.Write(name, kind, newEncrypted); err != nil {
+			return err
+		}
+		for i, r := range revs {
+			if err := t.WriteRevision(name, kind, r, revData[i]); err != nil {
+				return err
+			}
+		}
+		if meta == nil {
+			return nil
+		}
+		return t.WriteMeta(name, kind, meta)
+	}
+
+	failed := map[string]error{}
+	for i, name := range names {
+		fmt.Printf("[%d/%d] Re-encrypting %s (type %s)... ", i+1, len(names), name, list[name])
+		if err := rekey(name, list[name]); err != nil {
+			fmt.Printf("failed\n")
+			failed[name] = err
+			continue
+		}
+		fmt.Printf("done!\n")
+	}
+
+	// the old key stays a recipient until every entry has been converted,
+	// nothing is changed otherwise
+	if len(failed) > 0 {
+		t.Rollback()
+		fmt.Printf("\nThe following entries could not be converted, no entry has been changed:\n")
+		for _, name := range names {
+			if err, ok := failed[name]; ok {
+				fmt.Printf("\t%s (type %s): %s\n", name, list[name], err.Error())
+			}
+		}
+		os.Exit(-1)
+	}
+
+	err = t.WriteManifest(c)
+	if err != nil {
+		t.Rollback()
+		exitOnErr(err)
+	}
+	if replaced {
+		err = t.WriteRecipients(rs)
+		if err != nil {
+			t.Rollback()
+			exitOnErr(err)
+		}
+	}
+	if aclChanged {
+		err = t.WriteACL(acl)
+		if err != nil {
+			t.Rollback()
+			exitOnErr(err)
+		}
+	}
+
+	// a share of the recovery key held by the old key is handed over as well
+	rc, err := b.Recovery()
+	if err != nil {
+		t.Rollback()
+		exitOnErr(err)
+	}
+	for i, share := range rc.Shares {
+		if share.Holder != oldFingerprint {
+			continue
+		}
+		err = func() error {
+			data, err := decryptShare(c, share.Share, pw.Bytes())
+			if err != nil {
+				return fmt.Errorf("share of the recovery key could not be decrypted: %s", err.Error())
+			}
+			defer data.Destroy()
+			share, err := encryptShare(newKeys[0].recipient, data.Bytes())
+			if err != nil {
+				return err
+			}
+			rc.Shares[i].Share = share
+			rc.Shares[i].Holder = c.Fingerprint()
+			return t.WriteRecovery(rc)
+		}()
+		if err != nil {
+			t.Rollback()
+			exitOnErr(err)
+		}
+	}
+
+	// the new key becomes a trusted signer, the old one stays trusted to
+	// verify the entries signed while rekeying
+	ss, err := b.Signers()
+	if err != nil {
+		t.Rollback()
+		exitOnErr(err)
+	}
+	oldSigner := false
+	for _, s := range ss {
+		oldSigner = oldSigner || s.Fingerprint() == oldFingerprint
+	}
+	if oldSigner {
+		ss = append(ss, newSigners...)
+		err = t.WriteSigners(ss, c)
+		if err != nil {
+			t.Rollback()
+			exitOnErr(err)
+		}
+	}
+
+	// all entries are switched to the new key at once
+	err = t.Commit()
+	exitOnErr(err)
+
+	fmt.Printf("\nAll %d entries are now encrypted for %s\n", len(names), c.Fingerprint())
+	fmt.Printf("Make sure to set 'public_key' and 'private_key' in %s to the new key pair\n", a.cfg.configPath)
+	if oldSigner {
+		fmt.Printf("Your old key %s is still a trusted signer, remove it with 'scum signers remove' once all entries have been written with the new key\n", oldFingerprint)
+		fmt.Printf("The signers file is signed with your old key, pin your new key %s in trusted_signers before signing it again\n", c.Fingerprint())
+	}
+}
+
+func (a *App) hideCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	if b.Hidden() {
+		fmt.Printf("scum bag '%s' already hides the names of its entries\n", b.Base)
+		return
+	}
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+
+	// the manifest is signed like any entry
+	if !a.cfg.breakGlass {
+		pw, err := a.passphrase(cfg)
+		exitOnErr(err)
+		defer pw.Destroy()
+		err = a.sign(&c, pw.Bytes())
+		exitOnErr(err)
+	}
+
+	n, err := b.Hide(c)
+	exitOnErr(err)
+
+	fmt.Printf("%d entries were moved, their names are now listed in the encrypted manifest\n", n)
+	fmt.Printf("Earlier revisions of the bag, e.g. in its git history, still reveal the old names\n")
+}
+
+func (a *App) copyCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	// committed transactions are applied by opening the bag
+	src, err := a.newStore(cfg)
+	exitOnErr(err)
+	_, err = NewBag(src)
+	exitOnErr(err)
+
+	dstCfg, err := NewConfig(args[0])
+	exitOnErr(err)
+	dst, err := a.newStore(dstCfg)
+	exitOnErr(err)
+	skipNone := func(dir string) bool { return false }
+	existing, err := storeFiles(dst, "", skipNone)
+	exitOnErr(err)
+	if len(existing) > 0 {
+		exitOnErr(fmt.Errorf("scum bag '%s' is not empty", dst.String()))
+	}
+
+	// entries in folders and their metadata are copied as well, but no
+	// leftovers of a transaction which was never committed
+	files, err := storeFiles(src, "", func(dir string) bool { return dir == transactionDir })
+	exitOnErr(err)
+
+	// the recipients go first, a vault is encrypted for them from the start
+	sort.SliceStable(files, func(i, j int) bool { return files[i] == recipientsFile && files[j] != recipientsFile })
+	for i, file := range files {
+		fmt.Printf("[%d/%d] Copying %s... ", i+1, len(files), file)
+		data, err := src.Read(file)
+		exitOnErr(err)
+		err = dst.Write(file, data)
+		exitOnErr(err)
+		fmt.Printf("done!\n")
+	}
+	fmt.Printf("%d files copied from %s to %s\n", len(files), src.String(), dst.String())
+}
+
+func (a *App) agentCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	c, err := NewCrypt(cfg.Cipher, cfg.PublicKey, cfg.PrivateKey)
+	exitOnErr(err)
+
+	d := newDaemon(c, time.Duration(cfg.AgentIdleTTL)*time.Second, time.Duration(cfg.AgentTTL)*time.Second)
+	l, err := d.listen(cfg.AgentSocket)
+	exitOnErr(err)
+
+	// closing the listener removes the socket
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		<-sigs
+		close(stopped)
+		l.Close()
+	}()
+
+	fmt.Printf("scum agent listening on %s for key %s\n", cfg.AgentSocket, c.Fingerprint())
+	fmt.Printf("Unlock it with 'scum agent unlock' or by running any command asking for the passphrase\n")
+	err = d.serve(l)
+	select {
+	case <-stopped:
+		fmt.Printf("scum agent stopped\n")
+	default:
+		exitOnErr(err)
+	}
+}
+
+func (a *App) agentUnlockCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	client := daemonClient{socket: cfg.AgentSocket}
+	st, err := client.Status()
+	exitOnErr(err)
+	if st.Unlocked {
+		fmt.Printf("scum agent is already unlocked\n")
+		return
+	}
+
+	pw, err := promptPassword(cfg.PrivateKey, os.Stderr)
+	exitOnErr(err)
+	defer pw.Destroy()
+	err = client.Unlock(pw.Bytes())
+	exitOnErr(err)
+	fmt.Printf("scum agent unlocked\n")
+}
+
+func (a *App) agentLockCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	err = daemonClient{socket: cfg.AgentSocket}.Lock()
+	exitOnErr(err)
+	fmt.Printf("scum agent locked\n")
+}
+
+func (a *App) agentStatusCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	st, err := daemonClient{socket: cfg.AgentSocket}.Status()
+	exitOnErr(err)
+
+	fmt.Printf("scum agent running at %s\n", cfg.AgentSocket)
+	fmt.Printf("key: %s\n", st.Fingerprint)
+	if !st.Unlocked {
+		fmt.Printf("locked\n")
+		return
+	}
+	fmt.Printf("unlocked")
+	if !st.IdleExpiry.IsZero() {
+		fmt.Printf(", locks in %s unless used", time.Until(st.IdleExpiry).Round(time.Second))
+	}
+	if !st.Expiry.IsZero() {
+		fmt.Printf(", in %s at the latest", time.Until(st.Expiry).Round(time.Second))
+	}
+	fmt.Printf("\n")
+}
+
+func (a *App) forgetCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	forgotten, err := keyringForget(keyringDescription(cfg))
+	exitOnErr(err)
+	if !forgotten {
+		fmt.Printf("no passphrase cached\n")
+		return
+	}
+	fmt.Printf("passphrase forgotten\n")
+}
+
+func (a *App) versionCmd(cmd *cobra.Command, args []string) {
+	fmt.Println(versionInfo())
+}
+
+func (a *App) recoverInitCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	for _, r := range rs {
+		c.AddRecipients(r)
+	}
+
+	// the user may hold a share without being listed in the recipients file
+	data, err := ioutil.ReadFile(cfg.PublicKey)
+	exitOnErr(err)
+	self, comment, err := parseRecipient(data)
+	exitOnErr(err)
+	candidates := append([]bagRecipient{{recipient: self, Comment: comment}}, rs...)
+
+	holders := []bagRecipient{}
+	seen := map[string]bool{}
+	for _, id := range args {
+		fp, err := resolveRecipient(c, rs, id)
+		exitOnErr(err)
+		for _, r := range candidates {
+			if r.Fingerprint() != fp || seen[fp] {
+				continue
+			}
+			switch r.recipient.(type) {
+			case passphraseRecipient, recoveryRecipient:
+				exitOnErr(fmt.Errorf("%s (%s) is not an ssh key and cannot hold a share", fp, r.Comment))
+			}
+			seen[fp] = true
+			holders = append(holders, r)
+		}
+	}
+
+	key, err := newRecoveryKey()
+	exitOnErr(err)
+	shares, err := splitSecret(key.key[:], len(holders), a.cfg.threshold)
+	exitOnErr(err)
+
+	rc := recoveryConfig{Fingerprint: key.Fingerprint(), Threshold: a.cfg.threshold}
+	for i, h := range holders {
+		share, err := encryptShare(h.recipient, shares[i])
+		exitOnErr(err)
+		rc.Shares = append(rc.Shares, recoveryShare{Holder: h.Fingerprint(), Comment: h.Comment, Share: share})
+		fmt.Printf("Share %d goes to %s (%s)\n", i+1, h.Fingerprint(), h.Comment)
+	}
+
+	// there is only one recovery key per bag
+	kept := []bagRecipient{}
+	for _, r := range rs {
+		if _, ok := r.recipient.(recoveryRecipient); ok {
+			fmt.Printf("Replacing recovery key %s\n", r.Fingerprint())
+			continue
+		}
+		kept = append(kept, r)
+	}
+	rr := key.Recipient()
+	kept = append(kept, bagRecipient{recipient: rr, Comment: "recovery", Line: rr.String() + " recovery"})
+
+	t, err := b.Begin()
+	exitOnErr(err)
+	err = t.WriteRecipients(kept)
+	if err == nil {
+		err = t.WriteRecovery(rc)
+	}
+	if err != nil {
+		t.Rollback()
+		exitOnErr(err)
+	}
+	err = t.Commit()
+	exitOnErr(err)
+
+	fmt.Printf("Recovery key %s was split into %d shares, %d of them are required to recover the bag\n", rc.Fingerprint, len(holders), rc.Threshold)
+	a.recipientsSyncCmd(cmd, []string{})
+}
+
+func (a *App) recoverShareCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	rc, err := b.Recovery()
+	exitOnErr(err)
+	if rc.Fingerprint == "" {
+		exitOnErr(fmt.Errorf("bag has no recovery key, create one with 'scum recover init'"))
+	}
+	own, ok := rc.Share(c.Fingerprint())
+	if !ok {
+		exitOnErr(fmt.Errorf("your key %s does not hold a share of the recovery key", c.Fingerprint()))
+	}
+
+	data, err := ioutil.ReadFile(tidyPath(a.cfg.shareFor))
+	exitOnErr(err)
+	target, comment, err := parseRecipient(data)
+	exitOnErr(err)
+
+	// the share file is passed along from one participant to the next
+	sf := shareFile{Recovery: rc.Fingerprint, For: target.Fingerprint()}
+	data, err = ioutil.ReadFile(args[0])
+	if err == nil {
+		err = yaml.Unmarshal(data, &sf)
+		if err != nil {
+			exitOnErr(fmt.Errorf("share file '%s' is malformed: %s", args[0], err.Error()))
+		}
+		if sf.Recovery != rc.Fingerprint {
+			exitOnErr(fmt.Errorf("share file '%s' belongs to recovery key %s, the recovery key of the bag is %s", args[0], sf.Recovery, rc.Fingerprint))
+		}
+		if sf.For != target.Fingerprint() {
+			exitOnErr(fmt.Errorf("shares in '%s' are encrypted for %s, not for %s", args[0], sf.For, target.Fingerprint()))
+		}
+	} else if !os.IsNotExist(err) {
+		exitOnErr(err)
+	}
+	for _, s := range sf.Shares {
+		if s.Holder == own.Holder {
+			exitOnErr(fmt.Errorf("share file '%s' already contains your share", args[0]))
+		}
+	}
+
+	pw, err := a.passphrase(cfg)
+	exitOnErr(err)
+	defer pw.Destroy()
+	share, err := decryptShare(c, own.Share, pw.Bytes())
+	exitOnErr(err)
+	defer share.Destroy()
+	encrypted, err := encryptShare(target, share.Bytes())
+	exitOnErr(err)
+	sf.Shares = append(sf.Shares, recoveryShare{Holder: own.Holder, Comment: own.Comment, Share: encrypted})
+
+	data, err = yaml.Marshal(sf)
+	exitOnErr(err)
+	err = writeFileAtomic(args[0], data, 0600)
+	exitOnErr(err)
+
+	fmt.Printf("%d of %d required shares are collected for %s (%s)\n", len(sf.Shares), rc.Threshold, target.Fingerprint(), comment)
+	if len(sf.Shares) < rc.Threshold {
+		fmt.Printf("Pass '%s' on to the next holder of a share\n", args[0])
+	} else {
+		fmt.Printf("Pass '%s' on to the owner of the key to run 'scum recover %s'\n", args[0], args[0])
+	}
+}
+
+func (a *App) recoverCmd(cmd *cobra.Command, args []string) {
+	cfg, err := NewConfig(a.cfg.configPath)
+	exitOnErr(err)
+
+	c, err := a.newCrypt(cfg)
+	exitOnErr(err)
+
+	b, err := a.newBag(cfg)
+	exitOnErr(err)
+
+	err = a.trustSigners(cfg, b, &c)
+	exitOnErr(err)
+
+	rc, err := b.Recovery()
+	exitOnErr(err)
+	if rc.Fingerprint == "" {
+		exitOnErr(fmt.Errorf("bag has no recovery key"))
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	exitOnErr(err)
+	sf := shareFile{}
+	err = yaml.Unmarshal(data, &sf)
+	if err != nil {
+		exitOnErr(fmt.Errorf("share file '%s' is malformed: %s", args[0], err.Error()))
+	}
+	if sf.Recovery != rc.Fingerprint {
+		exitOnErr(fmt.Errorf("share file '%s' belongs to recovery key %s, the recovery key of the bag is %s", args[0], sf.Recovery, rc.Fingerprint))
+	}
+	if sf.For != c.Fingerprint() {
+		exitOnErr(fmt.Errorf("shares in '%s' are encrypted for %s, your key is %s", args[0], sf.For, c.Fingerprint()))
+	}
+	if len(sf.Shares) < rc.Threshold {
+		exitOnErr(fmt.Errorf("only %d of %d required shares are collected in '%s'", len(sf.Shares), rc.Threshold, args[0]))
+	}
+
+	pw, err := a.passphrase(cfg)
+	exitOnErr(err)
+	defer pw.Destroy()
+	shares := [][]byte{}
+	for _, s := range sf.Shares {
+		share, err := decryptShare(c, s.Share, pw.Bytes())
+		if err != nil {
+			exitOnErr(fmt.Errorf("share of %s (%s) could not be decrypted: %s", s.Holder, s.Comment, err.Error()))
+		}
+		defer share.Destroy()
+		shares = append(shares, share.Bytes())
+	}
+
+	secret, err := combineShares(shares)
+	exitOnErr(err)
+	key, err := newRecoveryIdentity(secret)
+	wipe(secret)
+	exitOnErr(err)
+	if key.Fingerprint() != rc.Fingerprint {
+		exitOnErr(fmt.Errorf("shares do not reassemble the recovery key"))
+	}
+	fmt.Printf("Recovery key %s reassembled\n", rc.Fingerprint)
+	c.UseRecoveryKey(key)
+
+	rs, err := b.Recipients()
+	exitOnErr(err)
+	listed := false
+	for _, r := range rs {
+		c.AddRecipients(r)
+		listed = listed || r.Fingerprint() == c.Fingerprint()
+	}
+	if !listed {
+		fmt.Printf("Your key is not listed in the recipients file, add it with 'scum recipients add' to keep access\n")
+	}
+
+	acl, err := b.ACL()
+	exitOnErr(err)
+
+	err = a.openManifest(cfg, &b, c)
+	exitOnErr(err)
+
+	a.syncEntries(cfg, b, c, rs, acl, func() (*SecretBuffer, error) { return pw, nil })
 }
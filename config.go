@@ -10,12 +10,43 @@ import (
 )
 
 type config struct {
-	BagPath       string `yaml:"bag_path"`
-	Mountpoint    string `yaml:"mountpoint"`
-	MountTimeout  int    `yaml:"mount_timeout"`
-	Debug         bool   `yaml:"debug"`
-	PrivateRSAKey string `yaml:"private_rsa_key"`
-	PublicRSAKey  string `yaml:"public_rsa_key"`
+	BagPath      string `yaml:"bag_path"`
+	Store        string `yaml:"store"`
+	S3Endpoint   string `yaml:"s3_endpoint"`
+	S3Region     string `yaml:"s3_region"`
+	S3Bucket     string `yaml:"s3_bucket"`
+	S3Prefix     string `yaml:"s3_prefix"`
+	Mountpoint   string `yaml:"mountpoint"`
+	MountTimeout int    `yaml:"mount_timeout"`
+	Workers      int    `yaml:"workers"`
+	Debug        bool   `yaml:"debug"`
+	PrivateKey   string `yaml:"private_key"`
+	PublicKey    string `yaml:"public_key"`
+	Cipher       string `yaml:"cipher"`
+	Padding      string `yaml:"padding"`
+	PaddingBlock int    `yaml:"padding_block"`
+	Metadata     string `yaml:"metadata"`
+	History      int    `yaml:"history"`
+	SSHAgent     bool   `yaml:"ssh_agent"`
+	AgentSocket  string `yaml:"agent_socket"`
+	AgentIdleTTL int    `yaml:"agent_idle_ttl"`
+	AgentTTL     int    `yaml:"agent_ttl"`
+	Keyring      bool   `yaml:"keyring"`
+	KeyringTTL   int    `yaml:"keyring_ttl"`
+	Signatures   string `yaml:"signatures"`
+
+	// TrustedSigners pins the fingerprints of the keys trusted to sign
+	// entries and the signers file of the bag.
+	TrustedSigners []string `yaml:"trusted_signers"`
+
+	// LegacyEntries is the policy for entries written by older versions of
+	// scum, which are not bound to their name and type.
+	LegacyEntries string `yaml:"legacy_entries"`
+
+	// Deprecated: these keys are still read for compatibility with older
+	// configuration files, use private_key and public_key instead.
+	PrivateRSAKey string `yaml:"private_rsa_key,omitempty"`
+	PublicRSAKey  string `yaml:"public_rsa_key,omitempty"`
 }
 
 func NewConfig(path string) (config, error) {
@@ -29,22 +60,106 @@ func NewConfig(path string) (config, error) {
 		return c, fmt.Errorf("could not read data from config file %s: %s", path, err.Error())
 	}
 
+	d := defaults()
+	if c.PrivateRSAKey != "" && c.PrivateKey == d.PrivateKey {
+		c.PrivateKey = c.PrivateRSAKey
+	}
+	if c.PublicRSAKey != "" && c.PublicKey == d.PublicKey {
+		c.PublicKey = c.PublicRSAKey
+	}
+	c.PrivateRSAKey = ""
+	c.PublicRSAKey = ""
+
+	// signatures are enforced by default once they can be verified
+	if c.Signatures == "" && len(c.TrustedSigners) > 0 {
+		c.Signatures = signaturesRefuse
+	} else if c.Signatures == "" {
+		c.Signatures = signaturesWarn
+	}
+	if c.Signatures != signaturesWarn && c.Signatures != signaturesRefuse {
+		return c, fmt.Errorf("signatures must be either '%s' or '%s', not '%s'", signaturesWarn, signaturesRefuse, c.Signatures)
+	}
+
+	if c.LegacyEntries == "" {
+		c.LegacyEntries = legacyWarn
+	}
+	if c.LegacyEntries != legacyWarn && c.LegacyEntries != legacyRefuse {
+		return c, fmt.Errorf("legacy_entries must be either '%s' or '%s', not '%s'", legacyWarn, legacyRefuse, c.LegacyEntries)
+	}
+
+	switch c.Store {
+	case storeDir, storeVault:
+	case storeS3:
+		if c.S3Bucket == "" {
+			return c, fmt.Errorf("s3_bucket must be set for store '%s'", storeS3)
+		}
+	default:
+		return c, fmt.Errorf("store must be one of '%s', '%s' or '%s', not '%s'", storeDir, storeVault, storeS3, c.Store)
+	}
+
+	if c.Workers < 1 {
+		return c, fmt.Errorf("workers must be at least 1, not %d", c.Workers)
+	}
+
+	if c.AgentIdleTTL < 0 || c.AgentTTL < 0 {
+		return c, fmt.Errorf("agent_idle_ttl and agent_ttl must not be negative, use 0 to disable them")
+	}
+
+	if _, err := newPadding(c.Padding, c.PaddingBlock); err != nil {
+		return c, err
+	}
+
+	if c.Metadata != metadataEncrypted && c.Metadata != metadataPlain {
+		return c, fmt.Errorf("metadata must be either '%s' or '%s', not '%s'", metadataEncrypted, metadataPlain, c.Metadata)
+	}
+
+	if c.History < 0 {
+		return c, fmt.Errorf("history must not be negative, use 0 to keep no previous revisions")
+	}
+
+	if c.Keyring && !keyringSupported {
+		return c, fmt.Errorf("keyring is only supported on Linux")
+	}
+	if c.KeyringTTL < 1 {
+		return c, fmt.Errorf("keyring_ttl must be at least 1, not %d", c.KeyringTTL)
+	}
+
+	if c.Cipher != "" {
+		if _, err := NewCipher(c.Cipher); err != nil {
+			return c, err
+		}
+	}
+
 	c.BagPath = tidyPath(c.BagPath)
 	c.Mountpoint = tidyPath(c.Mountpoint)
-	c.PrivateRSAKey = tidyPath(c.PrivateRSAKey)
-	c.PublicRSAKey = tidyPath(c.PublicRSAKey)
+	c.PrivateKey = tidyPath(c.PrivateKey)
+	c.PublicKey = tidyPath(c.PublicKey)
+	c.AgentSocket = tidyPath(c.AgentSocket)
 
 	return c, nil
 }
 
 func defaults() config {
 	return config{
-		BagPath:       os.ExpandEnv("$HOME/.scumbag/"),
-		Mountpoint:    os.ExpandEnv("$HOME/.scum/"),
-		MountTimeout:  120,
-		Debug:         false,
-		PrivateRSAKey: "$HOME/.ssh/id_rsa",
-		PublicRSAKey:  "$HOME/.ssh/id_rsa.pub",
+		BagPath:      os.ExpandEnv("$HOME/.scumbag/"),
+		Store:        storeDir,
+		S3Region:     "us-east-1",
+		Mountpoint:   os.ExpandEnv("$HOME/.scum/"),
+		MountTimeout: 120,
+		Workers:      8,
+		Debug:        false,
+		PrivateKey:   "$HOME/.ssh/id_rsa",
+		PublicKey:    "$HOME/.ssh/id_rsa.pub",
+		Padding:      paddingPow2,
+		PaddingBlock: 256,
+		Metadata:     metadataEncrypted,
+		History:      10,
+		SSHAgent:     false,
+		AgentSocket:  defaultDaemonSocket(),
+		AgentIdleTTL: 900,
+		AgentTTL:     28800,
+		Keyring:      false,
+		KeyringTTL:   900,
 	}
 }
 
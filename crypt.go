@@ -1,166 +1,691 @@
 package main
 
 import (
-	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
-	"crypto/x509"
-	"encoding/base64"
-	"encoding/binary"
-	"encoding/pem"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
-	"math/big"
+	"os"
+	"sort"
 	"strings"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
+// recipient wraps file keys for a single public key.
+type recipient interface {
+	Wrap(fileKey []byte) (stanza, error)
+	Fingerprint() string
+}
+
+// identity unwraps file keys wrapped for its public key. Unwrap returns
+// errIdentityMismatch if the stanza was not meant for the identity.
+type identity interface {
+	Unwrap(s stanza) ([]byte, error)
+	Fingerprint() string
+}
+
+var errIdentityMismatch = fmt.Errorf("stanza does not match identity")
+
+// destroyer is implemented by identities and signers which can wipe their
+// private key once it is not needed anymore.
+type destroyer interface {
+	Destroy()
+}
+
+// destroy wipes the private key of an identity or signer if it supports it.
+func destroy(v interface{}) {
+	if d, ok := v.(destroyer); ok {
+		d.Destroy()
+	}
+}
+
 type Crypt struct {
-	publicKey       *rsa.PublicKey
-	privateKeyBlock *pem.Block
+	// self is the public key of the user, recipients holds all public keys
+	// files are encrypted for. kind is the name of the cipher of the key
+	// pair of the user.
+	self       recipient
+	recipients []recipient
+	kind       string
+
+	// the private key is only read once it is required, which is not the
+	// case when encrypting or if the key is held by an ssh-agent or the
+	// scum agent
+	privateKeyFile string
+	agent          *agentKey
+	daemon         *daemonKey
+	keys           *keyCache
+
+	// breakGlass is set if files are decrypted with the passphrase of a
+	// passphrase recipient instead of the private key
+	breakGlass *passphraseIdentity
+
+	// recovery is set if files are decrypted with the reassembled recovery
+	// key of the bag
+	recovery *recoveryIdentity
+
+	// signer signs every file written, the signatures of files read are
+	// verified against the fingerprints of the trusted signers unless
+	// trusted is nil
+	signer          ssh.Signer
+	trusted         map[string]bool
+	refuseUntrusted bool
+
+	// padding hides the size of the data written, see padding.go
+	padding padding
+
+	// legacy is the policy for files not bound to their entry, files are
+	// opened with a warning if empty
+	legacy string
 }
 
-func NewCrypt(pubFile, privFile string) (Crypt, error) {
-	c := Crypt{}
+// NewCrypt sets up the encryption for the key pair of the user, kind is the
+// name of its cipher. The cipher is detected from the public key if kind is
+// empty.
+func NewCrypt(kind, pubFile, privFile string) (Crypt, error) {
+	c := Crypt{kind: kind}
 
 	pubData, err := ioutil.ReadFile(pubFile)
 	if err != nil {
 		return c, fmt.Errorf("error while reading public key file %s: %s", pubFile, err.Error())
 	}
-	err = c.bytesToPublicKey(pubData)
+
+	var r recipient
+	if kind == "" {
+		c.kind, r, _, err = parseCipherRecipient(pubData)
+	} else {
+		var cipher Cipher
+		cipher, err = NewCipher(kind)
+		if err == nil {
+			r, _, err = cipher.ParseRecipient(pubData)
+		}
+		if err == errCipherMismatch {
+			err = fmt.Errorf("key is not a key of cipher '%s'", kind)
+		}
+	}
 	if err != nil {
-		return c, err
+		return c, fmt.Errorf("error while parsing public key file %s: %s", pubFile, err.Error())
 	}
+	c.self = r
+	c.recipients = []recipient{r}
+	c.privateKeyFile = privFile
+	c.keys = &keyCache{}
+
+	return c, nil
+}
 
-	privData, err := ioutil.ReadFile(privFile)
+// UseAgent makes c use the ssh-agent to decrypt files, the agent must hold
+// the key of the user. Files written from now on can be decrypted with the
+// agent as well.
+func (c *Crypt) UseAgent(a agent.Agent) error {
+	k, err := newAgentKey(a, c.Fingerprint())
 	if err != nil {
-		return c, fmt.Errorf("error while reading private key file %s: %s", privFile, err.Error())
+		return err
 	}
-	err = c.bytesToPrivateKeyBlock(privData)
+	c.agent = &k
+	return nil
+}
+
+// UseDaemon makes c use the key held by the scum agent instead of reading the
+// private key file, the agent must be unlocked.
+func (c *Crypt) UseDaemon(client daemonClient) error {
+	k, err := newDaemonKey(client, c.Fingerprint())
 	if err != nil {
-		return c, err
+		return err
 	}
+	c.daemon = &k
+	return nil
+}
 
-	return c, nil
+// UsePadding makes c pad data to the buckets of p before encrypting it.
+func (c *Crypt) UsePadding(p padding) {
+	c.padding = p
 }
 
-func (c Crypt) Encrypt(data []byte) ([]byte, error) {
-	return rsa.EncryptOAEP(sha1.New(), rand.Reader, c.publicKey, data, []byte("scum file"))
+// AddRecipients adds public keys files are encrypted for in addition to the
+// public key of the user.
+func (c *Crypt) AddRecipients(rs ...recipient) {
+	for _, r := range rs {
+		if br, ok := r.(bagRecipient); ok {
+			r = br.recipient
+		}
+		c.recipients = uniqueRecipients(append(c.recipients, r))
+	}
 }
 
-func (c Crypt) Decrypt(data, pass []byte) ([]byte, error) {
-	priv, err := c.getPrivateKey(pass)
+// UseBreakGlass makes c decrypt files with the passphrase of a passphrase
+// recipient, the passphrase is passed to Decrypt in place of the passphrase
+// of the private key.
+func (c *Crypt) UseBreakGlass() {
+	id := newPassphraseIdentity([]byte{})
+	c.breakGlass = &id
+}
+
+// UseRecoveryKey makes c decrypt files with the recovery key of the bag
+// instead of the private key.
+func (c *Crypt) UseRecoveryKey(id recoveryIdentity) {
+	c.recovery = &id
+}
+
+// UseSigner makes c sign every file it writes with the private key of the
+// user, or with the key held by the ssh-agent or the scum agent if c uses
+// one of them. Files stay unsigned if the cipher of the key is unable to
+// sign.
+func (c *Crypt) UseSigner(pass []byte) error {
+	if c.agent != nil {
+		signers, err := c.agent.agent.Signers()
+		if err != nil {
+			return fmt.Errorf("could not list keys of ssh-agent: %s", err.Error())
+		}
+		for _, s := range signers {
+			if ssh.FingerprintSHA256(s.PublicKey()) == c.agent.Fingerprint() {
+				c.signer = s
+				return nil
+			}
+		}
+		return fmt.Errorf("key %s is not available in ssh-agent, add it with ssh-add", c.agent.Fingerprint())
+	}
+	if c.daemon != nil {
+		signer, err := c.daemon.Signer()
+		c.signer = signer
+		return err
+	}
+
+	data, err := ioutil.ReadFile(c.privateKeyFile)
 	if err != nil {
-		return []byte{}, err
+		return fmt.Errorf("error while reading private key file %s: %s", c.privateKeyFile, err.Error())
 	}
-	return rsa.DecryptOAEP(sha1.New(), rand.Reader, priv, data, []byte("scum file"))
+	for _, name := range cr.ordered(c.kind) {
+		signer, err := cr[name].NewSigner(data, pass)
+		if err == errCipherMismatch {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("private key cannot be used for signing: %s", err.Error())
+		}
+		c.signer = signer
+		return nil
+	}
+	return fmt.Errorf("private key file %s is not supported by any cipher", c.privateKeyFile)
 }
 
-func (c *Crypt) bytesToPrivateKeyBlock(priv []byte) error {
-	block, _ := pem.Decode(priv)
-	if block == nil {
-		return fmt.Errorf("private key could not be decoded")
+// TrustSigners makes c verify the signature of every file it decrypts, files
+// not signed by one of the keys with the given fingerprints are refused or
+// only warned about.
+func (c *Crypt) TrustSigners(fingerprints []string, refuse bool) {
+	c.trusted = map[string]bool{}
+	for _, fp := range fingerprints {
+		c.trusted[fp] = true
 	}
-	c.privateKeyBlock = block
-	return nil
+	c.refuseUntrusted = refuse
+}
+
+// Unverified returns a copy of c which does not verify signatures, for files
+// which are never signed.
+func (c Crypt) Unverified() Crypt {
+	c.trusted = nil
+	c.refuseUntrusted = false
+	return c
+}
+
+// UseLegacyPolicy sets whether files written by older versions of scum,
+// which are not bound to their entry, are refused, opened with a warning or,
+// while they are re-encrypted, opened silently.
+func (c *Crypt) UseLegacyPolicy(policy string) {
+	c.legacy = policy
+}
+
+// Sign returns an SSHSIG signature of message made with the key set by
+// UseSigner.
+func (c Crypt) Sign(message []byte) ([]byte, error) {
+	if c.signer == nil {
+		return nil, fmt.Errorf("the private key is required to sign")
+	}
+	return signSSHSIG(c.signer, message)
 }
 
-func (c Crypt) getPrivateKey(password []byte) (*rsa.PrivateKey, error) {
-	enc := x509.IsEncryptedPEMBlock(c.privateKeyBlock)
-	b := c.privateKeyBlock.Bytes
-	var err error
-	if enc {
-		b, err = x509.DecryptPEMBlock(c.privateKeyBlock, password)
+// Encrypt seals data with a random per-file key using ChaCha20-Poly1305 and
+// wraps that key for every recipient. ad is authenticated along with data,
+// the same ad must be passed to Decrypt. The result is an envelope as
+// described in envelope.go.
+func (c Crypt) Encrypt(data, ad []byte) ([]byte, error) {
+	if len(c.recipients) == 0 {
+		return []byte{}, fmt.Errorf("no recipients to encrypt for")
+	}
+
+	fileKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return []byte{}, fmt.Errorf("could not generate file key: %s", err.Error())
+	}
+
+	stanzas := []stanza{}
+	for _, r := range c.recipients {
+		s, err := r.Wrap(fileKey)
 		if err != nil {
-			return nil, err
+			return []byte{}, fmt.Errorf("could not wrap file key for %s: %s", r.Fingerprint(), err.Error())
+		}
+		stanzas = append(stanzas, s)
+
+		if c.agent != nil && r.Fingerprint() == c.agent.Fingerprint() {
+			s, err := c.agent.Wrap(fileKey)
+			if err != nil {
+				return []byte{}, fmt.Errorf("could not wrap file key with ssh-agent: %s", err.Error())
+			}
+			stanzas = append(stanzas, s)
 		}
 	}
-	key, err := x509.ParsePKCS1PrivateKey(b)
+
+	aead, err := chacha20poly1305.New(fileKey)
 	if err != nil {
-		return nil, err
+		return []byte{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return []byte{}, fmt.Errorf("could not generate nonce: %s", err.Error())
 	}
-	return key, nil
-}
 
-func (c *Crypt) bytesToPublicKey(pub []byte) error {
-	tokens := strings.Split(string(pub), " ")
+	if c.padding.enabled() {
+		padded := pad(data, c.padding.size(len(data)))
+		defer padded.Destroy()
+		data = padded.Bytes()
+		ad = paddedAssociatedData(ad)
+	}
 
-	if len(tokens) < 2 {
-		return fmt.Errorf("invalid key format; must contain at least two fields (keytype data [comment])")
+	e := envelope{
+		Version: envelopeVersion,
+		Header: envelopeHeader{
+			Suite:      suiteChaCha20Poly1305,
+			Cipher:     c.kind,
+			Recipients: stanzas,
+			Padded:     c.padding.enabled(),
+		},
+		Payload: append(nonce, aead.Seal(nil, nonce, data, ad)...),
+	}
+	if c.signer == nil {
+		return e.Marshal()
 	}
 
-	key_type := tokens[0]
-	data, err := base64.StdEncoding.DecodeString(tokens[1])
+	unsigned, err := e.Marshal()
 	if err != nil {
-		return err
+		return []byte{}, err
+	}
+	e.Signature, err = signSSHSIG(c.signer, unsigned)
+	if err != nil {
+		return []byte{}, err
 	}
+	return e.Marshal()
+}
 
-	format, e, n, err := c.getRSAValues(data)
+// Decrypt opens data produced by Encrypt. Files written by older versions
+// of scum are opened according to the legacy policy of c, ad is not checked
+// for those. The caller destroys the returned buffer once done with it.
+func (c Crypt) Decrypt(data, ad, pass []byte) (*SecretBuffer, error) {
+	e, err := parseEnvelope(data)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if e.Version != envelopeVersionLegacy && e.Header.Suite != suiteChaCha20Poly1305 {
+		return nil, fmt.Errorf("cipher suite '%s' is not supported", e.Header.Suite)
 	}
 
-	if format != key_type {
-		return fmt.Errorf("key type said %s, but encoded format said %s. these should match", key_type, format)
+	if err := c.checkLegacy(e); err != nil {
+		return nil, err
+	}
+	if err := c.verify(e); err != nil {
+		return nil, err
 	}
 
-	c.publicKey = &rsa.PublicKey{
-		N: n,
-		E: int(e.Int64()),
+	if c.breakGlass != nil || c.recovery != nil {
+		if e.Version == envelopeVersionLegacy {
+			return nil, fmt.Errorf("file was written by an older version of scum and can only be decrypted with the private key")
+		}
+		var id identity
+		if c.recovery != nil {
+			id = *c.recovery
+		} else {
+			bg := *c.breakGlass
+			bg.pass = pass
+			id = bg
+		}
+		fileKey, err := unwrap(e, id)
+		if err != nil {
+			return nil, err
+		}
+		return openPayload(e, fileKey, ad)
 	}
 
-	return nil
-}
+	// the agent does not need any passphrase, it is therefore preferred
+	var fileKey []byte
+	var agentErr error
+	useKeyFile := true
+	if c.agent != nil && e.Version != envelopeVersionLegacy {
+		fileKey, agentErr = unwrap(e, c.agent)
+		useKeyFile = agentErr != nil
+	}
 
-func (c Crypt) readLength(data []byte) ([]byte, uint32, error) {
-	l_buf := data[0:4]
+	if useKeyFile {
+		id, err := c.getIdentity(pass)
+		if err != nil && agentErr != nil {
+			return nil, fmt.Errorf("%s; to make entries readable with ssh-agent re-encrypt them with access to the private key, e.g. with 'scum recipients sync'", agentErr.Error())
+		} else if err != nil {
+			return nil, err
+		}
+
+		if e.Version == envelopeVersionLegacy {
+			out, err := decryptLegacy(id, e.Payload)
+			if err != nil {
+				return nil, err
+			}
+			return NewSecretBufferFrom(out), nil
+		}
 
-	buf := bytes.NewBuffer(l_buf)
+		fileKey, err = unwrap(e, id)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	var length uint32
+	return openPayload(e, fileKey, ad)
+}
 
-	err := binary.Read(buf, binary.BigEndian, &length)
+// decryptLegacy opens the payload of a file written by an older version of
+// scum, which was encrypted for a single RSA key.
+func decryptLegacy(id identity, payload []byte) ([]byte, error) {
+	if k, ok := id.(daemonKey); ok {
+		return k.decryptLegacy(payload)
+	}
+	rsaID, ok := id.(rsaIdentity)
+	if !ok {
+		return nil, fmt.Errorf("file was written by an older version of scum and can only be decrypted with an RSA key")
+	}
+	return rsa.DecryptOAEP(sha1.New(), rand.Reader, rsaID.key, payload, []byte(oaepLabel))
+}
+
+// openPayload decrypts the payload of e straight into a SecretBuffer and
+// strips the padding, the file key is wiped afterwards.
+func openPayload(e envelope, fileKey, ad []byte) (*SecretBuffer, error) {
+	defer wipe(fileKey)
+
+	aead, err := chacha20poly1305.New(fileKey)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
+	if len(e.Payload) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("file is truncated")
+	}
+	nonce := e.Payload[:aead.NonceSize()]
+	ciphertext := e.Payload[aead.NonceSize():]
 
-	return data[4:], length, nil
+	padded := e.Version == envelopeVersion && e.Header.Padded
+	if e.Version != envelopeVersion {
+		ad = nil
+	} else if padded {
+		ad = paddedAssociatedData(ad)
+	}
+	out := NewSecretBuffer(len(ciphertext) - aead.Overhead())
+	if _, err := aead.Open(out.Bytes()[:0], nonce, ciphertext, ad); err != nil {
+		out.Destroy()
+		if e.Version != envelopeVersion {
+			return nil, err
+		}
+		return nil, fmt.Errorf("file could not be authenticated, it may have been renamed or swapped with another file")
+	}
+	if padded {
+		return unpad(out)
+	}
+	return out, nil
 }
 
-func (c Crypt) readBigInt(data []byte, length uint32) ([]byte, *big.Int, error) {
-	var bigint = new(big.Int)
-	bigint.SetBytes(data[0:length])
-	return data[length:], bigint, nil
+// Fingerprint returns the SHA256 fingerprint of the public key in the same
+// format as 'ssh-keygen -l' does.
+func (c Crypt) Fingerprint() string {
+	return c.self.Fingerprint()
 }
 
-func (c Crypt) getRSAValues(data []byte) (format string, e *big.Int, n *big.Int, err error) {
-	data, length, err := c.readLength(data)
+// PrivateKeyFingerprint returns the fingerprint of the private key, this
+// requires the private key to be decrypted.
+func (c Crypt) PrivateKeyFingerprint(pass []byte) (string, error) {
+	id, err := c.getIdentity(pass)
 	if err != nil {
-		return
+		return "", err
 	}
+	return id.Fingerprint(), nil
+}
+
+// keyCache keeps the private key of the user once it has been parsed, all
+// copies of a Crypt share it. The key is parsed again if a different
+// passphrase is given.
+type keyCache struct {
+	mu   sync.Mutex
+	pass [32]byte
+	id   identity
+}
 
-	format = string(data[0:length])
-	data = data[length:]
+// getIdentity returns the private key of the user, it is read only once per
+// process.
+func (c Crypt) getIdentity(pass []byte) (identity, error) {
+	if c.daemon != nil {
+		return *c.daemon, nil
+	}
+	if c.keys == nil {
+		return c.parseIdentity(pass)
+	}
 
-	data, length, err = c.readLength(data)
+	c.keys.mu.Lock()
+	defer c.keys.mu.Unlock()
+	sum := sha256.Sum256(pass)
+	if c.keys.id != nil && c.keys.pass == sum {
+		return c.keys.id, nil
+	}
+	id, err := c.parseIdentity(pass)
 	if err != nil {
-		return
+		return nil, err
 	}
+	c.keys.pass = sum
+	c.keys.id = id
+	return id, nil
+}
 
-	data, e, err = c.readBigInt(data, length)
+// parseIdentity reads the private key of the user, the cipher of the public
+// key is tried first.
+func (c Crypt) parseIdentity(pass []byte) (identity, error) {
+	data, err := ioutil.ReadFile(c.privateKeyFile)
 	if err != nil {
-		return
+		return nil, fmt.Errorf("error while reading private key file %s: %s", c.privateKeyFile, err.Error())
 	}
+	for _, name := range cr.ordered(c.kind) {
+		id, err := cr[name].ParseIdentity(data, pass)
+		if err == errCipherMismatch {
+			continue
+		}
+		return id, err
+	}
+	return nil, fmt.Errorf("private key file %s is not supported by any cipher (%s)", c.privateKeyFile, strings.Join(cr.List(), ", "))
+}
 
-	data, length, err = c.readLength(data)
-	if err != nil {
-		return
+// Restrict returns a copy of c which only encrypts for the recipients with
+// one of the given fingerprints, the passphrase recipients and the recovery
+// key.
+func (c Crypt) Restrict(fingerprints []string) Crypt {
+	allowed := map[string]bool{}
+	for _, fp := range fingerprints {
+		allowed[fp] = true
 	}
 
-	_, n, err = c.readBigInt(data, length)
+	rs := []recipient{}
+	for _, r := range c.recipients {
+		// passphrase recipients and the recovery key are meant to be able to
+		// decrypt everything
+		_, breakGlass := r.(passphraseRecipient)
+		_, recovery := r.(recoveryRecipient)
+		if allowed[r.Fingerprint()] || breakGlass || recovery {
+			rs = append(rs, r)
+		}
+	}
+	c.recipients = rs
+	return c
+}
+
+// Fingerprints returns the fingerprints of all recipients.
+func (c Crypt) Fingerprints() []string {
+	out := []string{}
+	for _, r := range c.recipients {
+		out = append(out, r.Fingerprint())
+	}
+	return out
+}
+
+// poly1305TagSize is the size of the tag appended to the sealed data.
+const poly1305TagSize = 16
+
+// IsCurrent tells whether data is an envelope of the current version which
+// has been encrypted for exactly the recipients of c, padded as configured,
+// and signed if c verifies signatures.
+func (c Crypt) IsCurrent(data []byte) bool {
+	e, err := parseEnvelope(data)
+	if err != nil || e.Version != envelopeVersion {
+		return false
+	}
+
+	// unsigned files are signed as soon as the bag has signers
+	if c.trusted != nil && len(e.Signature) == 0 {
+		return false
+	}
+
+	if c.agent != nil && !hasStanza(e, stanzaSSHAgent, c.agent.Fingerprint()) && hasStanza(e, "", c.agent.Fingerprint()) {
+		return false
+	}
+
+	// files not padded to one of the buckets of c are padded again, the
+	// actual size of the data is unknown without decrypting it
+	if e.Header.Padded != c.padding.enabled() {
+		return false
+	}
+	if e.Header.Padded && !c.padding.isBucket(len(e.Payload)-chacha20poly1305.NonceSize-poly1305TagSize) {
+		return false
+	}
+
+	want := c.Fingerprints()
+	got := e.Fingerprints()
+	if len(want) != len(got) {
+		return false
+	}
+	sort.Strings(want)
+	sort.Strings(got)
+	for i := range want {
+		if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkLegacy refuses or warns about e if it was written by an older version
+// of scum, depending on the legacy policy.
+func (c Crypt) checkLegacy(e envelope) error {
+	if e.Version == envelopeVersion || c.legacy == legacyUpgrade {
+		return nil
+	}
+	err := fmt.Errorf("file was written by an older version of scum and is not bound to its entry, it could have been renamed or swapped with another file; run 'scum recipients sync' to re-encrypt it")
+	if c.legacy == legacyRefuse {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "warning: %s\n", err.Error())
+	return nil
+}
+
+// verify checks the signature of e against the trusted signers. Depending on
+// the policy a file without trusted signature is refused or a warning is
+// printed.
+func (c Crypt) verify(e envelope) error {
+	if c.trusted == nil {
+		return nil
+	}
+	err := c.checkSignature(e)
+	if err == nil || c.refuseUntrusted {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "warning: %s\n", err.Error())
+	return nil
+}
+
+func (c Crypt) checkSignature(e envelope) error {
+	if len(e.Signature) == 0 {
+		return fmt.Errorf("file is not signed")
+	}
+	key, err := verifySSHSIG(e.Signature, e.signed)
 	if err != nil {
-		return
+		return err
+	}
+	fp := ssh.FingerprintSHA256(key)
+	if c.trusted[fp] {
+		return nil
+	}
+	return fmt.Errorf("file is signed by %s which is not a trusted signer", fp)
+}
+
+// hasStanza tells whether e contains a stanza of the given type (any type if
+// empty) for the given fingerprint.
+func hasStanza(e envelope, kind, fingerprint string) bool {
+	for _, s := range e.Header.Recipients {
+		if s.Fingerprint == fingerprint && (kind == "" || s.Type == kind) {
+			return true
+		}
+	}
+	return false
+}
+
+func unwrap(e envelope, id identity) ([]byte, error) {
+	var lastErr error
+	for _, s := range e.Header.Recipients {
+		if s.Fingerprint != "" && id.Fingerprint() != "" && s.Fingerprint != id.Fingerprint() {
+			continue
+		}
+		fileKey, err := id.Unwrap(s)
+		if err == nil {
+			return fileKey, nil
+		}
+		if err != errIdentityMismatch {
+			lastErr = err
+		}
+	}
+
+	// identities without fingerprint, such as a passphrase, can only tell
+	// why unwrapping failed
+	if id.Fingerprint() == "" {
+		if lastErr == nil {
+			return []byte{}, fmt.Errorf("this entry was not encrypted for a passphrase")
+		}
+		return []byte{}, lastErr
+	}
+
+	fingerprints := e.Fingerprints()
+	for _, fp := range fingerprints {
+		if fp == id.Fingerprint() {
+			return []byte{}, fmt.Errorf("file key could not be unwrapped with key %s", id.Fingerprint())
+		}
+	}
+	if len(fingerprints) == 0 {
+		return []byte{}, fmt.Errorf("file key could not be unwrapped with key %s", id.Fingerprint())
+	}
+	return []byte{}, fmt.Errorf("this entry was encrypted for key %s, your key is %s", strings.Join(fingerprints, ", "), id.Fingerprint())
+}
+
+// parseRecipient reads a public key of any cipher, a passphrase recipient or
+// a recovery key, and returns it along with its comment.
+func parseRecipient(in []byte) (recipient, string, error) {
+	if strings.HasPrefix(string(in), passphraseKeyType+" ") {
+		return parsePassphraseRecipient(string(in))
+	}
+	if strings.HasPrefix(string(in), recoveryKeyType+" ") {
+		return parseRecoveryRecipient(string(in))
 	}
 
-	return
+	_, r, comment, err := parseCipherRecipient(in)
+	return r, comment, err
 }
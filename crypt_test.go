@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDecryptLegacyPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pub, priv := testKeyPair(t, dir, "own")
+	c, err := NewCrypt("", pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ad := entryAssociatedData("prod", "aws")
+
+	current, err := c.Encrypt([]byte("secret"), ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a version 2 file has the same layout, its payload is sealed without
+	// associated data
+	unbound, err := c.Encrypt([]byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unbound[len(envelopeMagic)] = envelopeVersionUnbound
+
+	data, err := ioutil.ReadFile(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, &key.PublicKey, []byte("secret"), []byte(oaepLabel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, policy := range []string{legacyWarn, legacyRefuse, legacyUpgrade} {
+		c.UseLegacyPolicy(policy)
+		for name, data := range map[string][]byte{"current": current, "unbound": unbound, "legacy": legacy} {
+			out, err := c.Decrypt(data, ad, []byte{})
+			if policy == legacyRefuse && name != "current" {
+				if err == nil {
+					out.Destroy()
+					t.Errorf("%s: %s file opened", policy, name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %s file: %s", policy, name, err)
+				continue
+			}
+			if string(out.Bytes()) != "secret" {
+				t.Errorf("%s: %s file: unexpected content %q", policy, name, out.Bytes())
+			}
+			out.Destroy()
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The scum agent is a daemon holding the unlocked private key of the user,
+// so that the passphrase does not need to be typed for every command. The key
+// never leaves the daemon: clients send it the stanzas of a file and get the
+// file key back, or have it sign the hash of a file, much like ssh-agent.
+// Unlike ssh-agent it does not sign arbitrary data, signatures are always
+// made in the SSHSIG format with the namespace of scum. The daemon forgets
+// the key once it has not been used for the idle TTL or once the absolute
+// TTL has passed since it was unlocked.
+//
+// Clients connect to a Unix socket in a directory only accessible by the
+// user and send a single JSON encoded request per connection.
+const (
+	daemonOpStatus = "status"
+	daemonOpUnlock = "unlock"
+	daemonOpLock   = "lock"
+	daemonOpUnwrap = "unwrap"
+	daemonOpLegacy = "decrypt-legacy"
+	daemonOpSign   = "sign"
+)
+
+type daemonRequest struct {
+	Op         string `json:"op"`
+	Passphrase []byte `json:"passphrase,omitempty"`
+	Stanza     stanza `json:"stanza"`
+	Data       []byte `json:"data,omitempty"`
+}
+
+type daemonResponse struct {
+	Error    string       `json:"error,omitempty"`
+	Mismatch bool         `json:"mismatch,omitempty"`
+	Data     []byte       `json:"data,omitempty"`
+	Status   daemonStatus `json:"status"`
+}
+
+// daemonStatus describes the key held by the daemon. SignerKey is the public
+// key in the wire format if the key is able to sign. The expiry times are
+// zero if the respective TTL is disabled.
+type daemonStatus struct {
+	Fingerprint string    `json:"fingerprint"`
+	Unlocked    bool      `json:"unlocked"`
+	SignerKey   []byte    `json:"signer_key,omitempty"`
+	IdleExpiry  time.Time `json:"idle_expiry,omitempty"`
+	Expiry      time.Time `json:"expiry,omitempty"`
+}
+
+// defaultDaemonSocket returns the socket in $XDG_RUNTIME_DIR, or in a
+// directory of the user in the temporary directory.
+func defaultDaemonSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "scum", "agent.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("scum-%d", os.Getuid()), "agent.sock")
+}
+
+// checkSocketDir makes sure that nobody but the user is able to tamper with
+// the socket in dir.
+func checkSocketDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("directory %s of the scum agent socket is not owned by the user", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("directory %s of the scum agent socket must not be accessible by other users", dir)
+	}
+	return nil
+}
+
+// daemon serves the key of crypt.
+type daemon struct {
+	crypt   Crypt
+	idleTTL time.Duration
+	ttl     time.Duration
+
+	mu         sync.Mutex
+	id         identity
+	signer     ssh.Signer
+	unlockedAt time.Time
+	usedAt     time.Time
+
+	// inUse is held for reading while a request uses the key, it is only
+	// wiped once they are done
+	inUse sync.RWMutex
+}
+
+func newDaemon(c Crypt, idleTTL, ttl time.Duration) *daemon {
+	return &daemon{crypt: c, idleTTL: idleTTL, ttl: ttl}
+}
+
+// listen creates the socket, a stale socket of a daemon which is not running
+// anymore is replaced.
+func (d *daemon) listen(socket string) (net.Listener, error) {
+	dir := filepath.Dir(socket)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := checkSocketDir(dir); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(socket); err == nil {
+		if _, err := (daemonClient{socket: socket}).Status(); err == nil {
+			return nil, fmt.Errorf("scum agent is already running at %s", socket)
+		}
+		if err := os.Remove(socket); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	return l, os.Chmod(socket, 0600)
+}
+
+// serve handles connections until l is closed.
+func (d *daemon) serve(l net.Listener) error {
+	go func() {
+		for range time.Tick(time.Second) {
+			d.expire()
+		}
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go d.handle(conn)
+	}
+}
+
+func (d *daemon) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	var req daemonRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	resp := d.do(req)
+	wipe(req.Passphrase)
+	json.NewEncoder(conn).Encode(resp)
+	wipe(resp.Data)
+}
+
+func (d *daemon) do(req daemonRequest) daemonResponse {
+	var err error
+	resp := daemonResponse{}
+	switch req.Op {
+	case daemonOpStatus:
+	case daemonOpUnlock:
+		d.mu.Lock()
+		err = d.unlock(req.Passphrase)
+		d.mu.Unlock()
+	case daemonOpLock:
+		d.mu.Lock()
+		d.lock()
+		d.mu.Unlock()
+	case daemonOpUnwrap, daemonOpLegacy, daemonOpSign:
+		resp.Data, err = d.use(req)
+		resp.Mismatch = err == errIdentityMismatch
+	default:
+		err = fmt.Errorf("unknown request '%s'", req.Op)
+	}
+
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	d.mu.Lock()
+	resp.Status = d.status()
+	d.mu.Unlock()
+	return resp
+}
+
+// use handles the requests which require the key, the lock is not held
+// while the key is used so that requests are served in parallel.
+func (d *daemon) use(req daemonRequest) ([]byte, error) {
+	d.mu.Lock()
+	id, signer := d.id, d.signer
+	d.usedAt = time.Now()
+	d.inUse.RLock()
+	d.mu.Unlock()
+	defer d.inUse.RUnlock()
+	if id == nil {
+		return nil, fmt.Errorf("scum agent is locked")
+	}
+
+	switch req.Op {
+	case daemonOpUnwrap:
+		return id.Unwrap(req.Stanza)
+	case daemonOpLegacy:
+		return decryptLegacy(id, req.Data)
+	default:
+		if signer == nil {
+			return nil, fmt.Errorf("key cannot be used for signing")
+		}
+		// the signature is made over the SSHSIG data of scum for the hash
+		// of a file, the key cannot be abused to sign anything else
+		return signSSHSIGHash(signer, req.Data)
+	}
+}
+
+func (d *daemon) unlock(pass []byte) error {
+	id, err := d.crypt.parseIdentity(pass)
+	if err != nil {
+		return err
+	}
+	if id.Fingerprint() != d.crypt.Fingerprint() {
+		destroy(id)
+		return fmt.Errorf("private key %s does not match public key %s", id.Fingerprint(), d.crypt.Fingerprint())
+	}
+	c := d.crypt
+	if err := c.UseSigner(pass); err != nil {
+		destroy(id)
+		return err
+	}
+
+	d.lock()
+	d.id = id
+	d.signer = c.signer
+	d.unlockedAt = time.Now()
+	d.usedAt = d.unlockedAt
+	return nil
+}
+
+// lock wipes the key once the requests using it are done and forgets it.
+func (d *daemon) lock() {
+	d.inUse.Lock()
+	defer d.inUse.Unlock()
+	destroy(d.id)
+	destroy(d.signer)
+	d.id = nil
+	d.signer = nil
+}
+
+// expire locks the daemon once one of the TTLs has passed.
+func (d *daemon) expire() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.id == nil {
+		return
+	}
+	st := d.status()
+	now := time.Now()
+	if (!st.IdleExpiry.IsZero() && now.After(st.IdleExpiry)) || (!st.Expiry.IsZero() && now.After(st.Expiry)) {
+		d.lock()
+		fmt.Fprintf(os.Stderr, "%s key locked after its TTL expired\n", now.Format(time.RFC3339))
+	}
+}
+
+func (d *daemon) status() daemonStatus {
+	st := daemonStatus{Fingerprint: d.crypt.Fingerprint(), Unlocked: d.id != nil}
+	if !st.Unlocked {
+		return st
+	}
+	if d.signer != nil {
+		st.SignerKey = d.signer.PublicKey().Marshal()
+	}
+	if d.idleTTL > 0 {
+		st.IdleExpiry = d.usedAt.Add(d.idleTTL)
+	}
+	if d.ttl > 0 {
+		st.Expiry = d.unlockedAt.Add(d.ttl)
+	}
+	return st
+}
+
+// daemonClient talks to the scum agent listening on socket.
+type daemonClient struct {
+	socket string
+}
+
+func (d daemonClient) call(req daemonRequest) (daemonResponse, error) {
+	resp := daemonResponse{}
+	if err := checkSocketDir(filepath.Dir(d.socket)); err != nil {
+		return resp, err
+	}
+	conn, err := net.DialTimeout("unix", d.socket, time.Second)
+	if err != nil {
+		return resp, fmt.Errorf("scum agent is not running at %s", d.socket)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, fmt.Errorf("could not talk to scum agent: %s", err.Error())
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("could not talk to scum agent: %s", err.Error())
+	}
+	if resp.Mismatch {
+		return resp, errIdentityMismatch
+	}
+	if resp.Error != "" {
+		return resp, fmt.Errorf("scum agent: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// Status returns the status of the daemon, or an error if it is not running.
+func (d daemonClient) Status() (daemonStatus, error) {
+	resp, err := d.call(daemonRequest{Op: daemonOpStatus})
+	return resp.Status, err
+}
+
+// Unlock makes the daemon read the private key with the passphrase pass.
+func (d daemonClient) Unlock(pass []byte) error {
+	_, err := d.call(daemonRequest{Op: daemonOpUnlock, Passphrase: pass})
+	return err
+}
+
+// Lock makes the daemon forget the private key.
+func (d daemonClient) Lock() error {
+	_, err := d.call(daemonRequest{Op: daemonOpLock})
+	return err
+}
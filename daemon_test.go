@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestDaemonLockWipesKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := newEd25519Identity(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := newSSHSigner(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newDaemon(Crypt{}, 0, 0)
+	d.id, d.signer = id, signer
+	d.lock()
+
+	if d.id != nil || d.signer != nil {
+		t.Fatal("key not forgotten")
+	}
+	if id.(*ed25519Identity).key != [32]byte{} {
+		t.Error("identity not wiped")
+	}
+	for _, w := range rsaKey.D.Bits() {
+		if w != 0 {
+			t.Fatal("signing key not wiped")
+		}
+	}
+}
+
+func TestDaemonSignsOnlyHashes(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := newEd25519Identity(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := newSSHSigner(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newDaemon(Crypt{}, 0, 0)
+	d.id, d.signer = id, signer
+
+	message := []byte("entry")
+	hash := sha512.Sum512(message)
+	sig, err := d.use(daemonRequest{Op: daemonOpSign, Data: hash[:]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifySSHSIG(sig, message); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.use(daemonRequest{Op: daemonOpSign, Data: []byte("arbitrary data")}); err == nil {
+		t.Fatal("arbitrary data signed")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// A scum file (envelope) is laid out as follows:
+//
+//	magic ("SCUM") | version (1 byte) | section...
+//
+// where each section is encoded as
+//
+//	type (1 byte) | length (uint32, big endian) | data
+//
+// The header section is a JSON document describing the cipher suite as well
+// as the recipients the file key has been wrapped for, the payload section
+// holds the nonce followed by the sealed data. The associated data of the
+// payload identifies the entry (see entryAssociatedData), a file moved to
+// another entry therefore fails to decrypt. The optional signature section
+// holds an SSHSIG signature (see sshsig.go) of the writer over everything
+// preceding it and must be the last section.
+const (
+	envelopeMagic = "SCUM"
+
+	// envelopeVersionLegacy marks files without any header which hold the
+	// secret encrypted directly with RSA-OAEP/SHA-1.
+	envelopeVersionLegacy = 0
+	// envelopeVersionHybrid marks files consisting of a single RSA wrapped
+	// key followed by nonce and ciphertext, without any further information.
+	envelopeVersionHybrid = 1
+	// envelopeVersionUnbound marks files with the current layout whose
+	// payload is not bound to the name and type of the entry.
+	envelopeVersionUnbound = 2
+	// envelopeVersion is the version written by this version of scum.
+	envelopeVersion = 3
+
+	sectionHeader    = 1
+	sectionPayload   = 2
+	sectionSignature = 3
+
+	suiteChaCha20Poly1305 = "chacha20poly1305"
+)
+
+// The policy for files written before envelopeVersion, which are not bound to
+// their entry, see the option 'legacy_entries' of the configuration.
+// legacyUpgrade opens them without warning while they are re-encrypted.
+const (
+	legacyWarn    = "warn"
+	legacyRefuse  = "refuse"
+	legacyUpgrade = "upgrade"
+)
+
+type envelope struct {
+	Version   int
+	Header    envelopeHeader
+	Payload   []byte
+	Signature []byte
+
+	// signed is the part of the file covered by the signature
+	signed []byte
+}
+
+// envelopeHeader records the cipher of the key pair of the writer, the
+// ciphers of the recipients are given by the types of the stanzas.
+type envelopeHeader struct {
+	Suite      string   `json:"suite"`
+	Cipher     string   `json:"cipher,omitempty"`
+	Recipients []stanza `json:"recipients"`
+	Padded     bool     `json:"padded,omitempty"`
+}
+
+// stanza holds the file key wrapped for a single recipient.
+type stanza struct {
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	Body        []byte `json:"body"`
+}
+
+func (e envelope) Marshal() ([]byte, error) {
+	header, err := json.Marshal(e.Header)
+	if err != nil {
+		return []byte{}, fmt.Errorf("could not encode header: %s", err.Error())
+	}
+
+	out := bytes.NewBufferString(envelopeMagic)
+	out.WriteByte(envelopeVersion)
+	writeSection(out, sectionHeader, header)
+	writeSection(out, sectionPayload, e.Payload)
+	if len(e.Signature) > 0 {
+		writeSection(out, sectionSignature, e.Signature)
+	}
+	return out.Bytes(), nil
+}
+
+// Fingerprints returns the fingerprints of all recipients of the envelope.
+func (e envelope) Fingerprints() []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, s := range e.Header.Recipients {
+		if s.Fingerprint != "" && !seen[s.Fingerprint] {
+			out = append(out, s.Fingerprint)
+			seen[s.Fingerprint] = true
+		}
+	}
+	return out
+}
+
+// readersOf returns the fingerprints of the keys data has been encrypted
+// for, this works without decrypting the data.
+func readersOf(data []byte) []string {
+	e, err := parseEnvelope(data)
+	if err != nil {
+		return []string{}
+	}
+	return e.Fingerprints()
+}
+
+func parseEnvelope(data []byte) (envelope, error) {
+	e := envelope{}
+	file := data
+	if !bytes.HasPrefix(data, []byte(envelopeMagic)) {
+		e.Version = envelopeVersionLegacy
+		e.Payload = data
+		return e, nil
+	}
+
+	data = data[len(envelopeMagic):]
+	if len(data) < 1 {
+		return e, fmt.Errorf("file is truncated")
+	}
+	e.Version = int(data[0])
+	data = data[1:]
+
+	switch e.Version {
+	case envelopeVersionHybrid:
+		return parseHybridEnvelope(e, data)
+	case envelopeVersionUnbound, envelopeVersion:
+	default:
+		return e, fmt.Errorf("file format version %d is not supported", e.Version)
+	}
+
+	hasHeader, hasPayload := false, false
+	for len(data) > 0 {
+		if len(e.Signature) > 0 {
+			return e, fmt.Errorf("file contains data after the signature")
+		}
+		if len(data) < 5 {
+			return e, fmt.Errorf("file is truncated")
+		}
+		start := len(file) - len(data)
+		kind := data[0]
+		length := binary.BigEndian.Uint32(data[1:5])
+		data = data[5:]
+		if uint32(len(data)) < length {
+			return e, fmt.Errorf("file is truncated")
+		}
+		section := data[:length]
+		data = data[length:]
+
+		switch kind {
+		case sectionHeader:
+			if err := json.Unmarshal(section, &e.Header); err != nil {
+				return e, fmt.Errorf("could not decode header: %s", err.Error())
+			}
+			hasHeader = true
+		case sectionPayload:
+			e.Payload = section
+			hasPayload = true
+		case sectionSignature:
+			if len(section) == 0 {
+				return e, fmt.Errorf("file contains empty signature")
+			}
+			e.Signature = section
+			e.signed = file[:start]
+		default:
+			return e, fmt.Errorf("file contains unknown section of type %d", kind)
+		}
+	}
+
+	if !hasHeader || !hasPayload {
+		return e, fmt.Errorf("file is incomplete")
+	}
+
+	return e, nil
+}
+
+// parseHybridEnvelope converts the version 1 layout
+//
+//	len(wrapped key) (uint16) | wrapped key | nonce | ciphertext
+//
+// into an envelope. Since version 1 did not record any fingerprint the single
+// recipient is left anonymous.
+func parseHybridEnvelope(e envelope, data []byte) (envelope, error) {
+	if len(data) < 2 {
+		return e, fmt.Errorf("file is truncated")
+	}
+	wrappedLen := int(binary.BigEndian.Uint16(data[:2]))
+	data = data[2:]
+	if len(data) < wrappedLen {
+		return e, fmt.Errorf("file is truncated")
+	}
+
+	e.Header = envelopeHeader{
+		Suite: suiteChaCha20Poly1305,
+		Recipients: []stanza{
+			{Type: stanzaRSAOAEP, Body: data[:wrappedLen]},
+		},
+	}
+	e.Payload = data[wrappedLen:]
+	return e, nil
+}
+
+func writeSection(out *bytes.Buffer, kind byte, data []byte) {
+	out.WriteByte(kind)
+	binary.Write(out, binary.BigEndian, uint32(len(data)))
+	out.Write(data)
+}
+
+// signerOf returns the key which signed data, the signature is verified but
+// not whether the signer is trusted. The key is nil for unsigned data.
+func signerOf(data []byte) (ssh.PublicKey, error) {
+	e, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Signature) == 0 {
+		return nil, nil
+	}
+	return verifySSHSIG(e.Signature, e.signed)
+}
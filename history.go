@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// The previous revisions of an entry are kept in the directory historyDir of
+// the bag, below the name of the file of the entry. A revision is the entry
+// as it was encrypted and signed back then, its file is named by the number
+// of the revision and the time it was written.
+const historyDir = ".history"
+
+type Revision struct {
+	Rev     int
+	Written time.Time
+
+	file string
+}
+
+func revisionFile(file string, rev int, written time.Time) string {
+	return path.Join(historyDir, file, fmt.Sprintf("%d-%d", rev, written.Unix()))
+}
+
+// revisions lists the revisions kept of the entry file, the oldest first.
+func (b Bag) revisions(file string) ([]Revision, error) {
+	files, err := b.store.List(path.Join(historyDir, file))
+	if err != nil {
+		return nil, err
+	}
+
+	out := []Revision{}
+	for _, f := range files {
+		var rev int
+		var written int64
+		if _, err := fmt.Sscanf(path.Base(f), "%d-%d", &rev, &written); err != nil {
+			return nil, fmt.Errorf("scum bag '%s' contains malformed revision: %s", b.Base, f)
+		}
+		out = append(out, Revision{Rev: rev, Written: time.Unix(written, 0), file: f})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Rev < out[j].Rev })
+	return out, nil
+}
+
+// History lists the previous revisions of an entry, the oldest first.
+func (b Bag) History(name, kind string) ([]Revision, error) {
+	file, err := b.entryFile(name, kind, false)
+	if err != nil {
+		return nil, err
+	}
+	return b.revisions(file)
+}
+
+// ReadRevision returns a previous revision of an entry as listed by History.
+func (b Bag) ReadRevision(r Revision) ([]byte, error) {
+	return b.store.Read(r.file)
+}
+
+// archive keeps the current content of the entry file as its latest revision
+// before it is replaced, and drops the oldest revisions beyond the retention.
+func (b Bag) archive(file string) error {
+	if b.history == 0 {
+		return nil
+	}
+
+	info, err := b.store.Stat(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	data, err := b.store.Read(file)
+	if err != nil {
+		return err
+	}
+
+	revs, err := b.revisions(file)
+	if err != nil {
+		return err
+	}
+	rev := 1
+	if len(revs) > 0 {
+		rev = revs[len(revs)-1].Rev + 1
+	}
+	f := revisionFile(file, rev, info.ModTime)
+	if err := b.store.Write(f, data); err != nil {
+		return fmt.Errorf("revision %d of '%s' could not be kept: %s", rev, file, err.Error())
+	}
+	revs = append(revs, Revision{Rev: rev, Written: info.ModTime, file: f})
+
+	for len(revs) > b.history {
+		if err := b.store.Delete(revs[0].file); err != nil {
+			return err
+		}
+		revs = revs[1:]
+	}
+	return nil
+}
+
+// WriteRevision stages a revision of an entry to be written on commit, e.g.
+// re-encrypted for a new key.
+func (t Transaction) WriteRevision(name, kind string, r Revision, data []byte) error {
+	file, err := t.bag.entryFile(name, kind, true)
+	if err != nil {
+		return err
+	}
+	return t.stage(revisionFile(file, r.Rev, r.Written), data)
+}
+
+// profileFields returns the fields of a decrypted entry for comparison, all
+// types serialize their profiles as JSON objects.
+func profileFields(data []byte) (map[string]string, error) {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("entry cannot be compared: %s", err.Error())
+	}
+
+	out := map[string]string{}
+	for key, value := range raw {
+		out[key] = fmt.Sprint(value)
+	}
+	return out, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testKeyPair writes an unencrypted RSA key pair to dir and returns the
+// paths of the public and the private key.
+func testKeyPair(t *testing.T, dir, name string) (string, string) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privFile := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	if err := ioutil.WriteFile(privFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	pubFile := privFile + ".pub"
+	if err := ioutil.WriteFile(pubFile, ssh.MarshalAuthorizedKey(pub), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return pubFile, privFile
+}
+
+func TestSyncEntriesReencryptsRevisions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ownPub, ownPriv := testKeyPair(t, dir, "own")
+	otherPub, otherPriv := testKeyPair(t, dir, "other")
+
+	own, err := NewCrypt("", ownPub, ownPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewCrypt("", otherPub, otherPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := filepath.Join(dir, "bag")
+	if err := os.Mkdir(base, 0700); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newDirStore(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBag(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.KeepHistory(10)
+
+	// the first revision is written for the own key only
+	for _, content := range []string{`{"v":"1"}`, `{"v":"2"}`} {
+		data, err := own.Encrypt([]byte(content), entryAssociatedData("prod", "aws"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Write("prod", "aws", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readRevision := func(c Crypt) error {
+		revs, err := b.History("prod", "aws")
+		if err != nil {
+			return err
+		}
+		if len(revs) != 1 {
+			t.Fatalf("expected one revision, got %d", len(revs))
+		}
+		data, err := b.ReadRevision(revs[0])
+		if err != nil {
+			return err
+		}
+		out, err := c.Decrypt(data, entryAssociatedData("prod", "aws"), []byte{})
+		if err != nil {
+			return err
+		}
+		defer out.Destroy()
+		if string(out.Bytes()) != `{"v":"1"}` {
+			t.Fatalf("unexpected revision %s", out.Bytes())
+		}
+		return nil
+	}
+	if err := readRevision(other); err == nil {
+		t.Fatal("revision readable before the recipient was added")
+	}
+
+	a := &App{}
+	pass := func() (*SecretBuffer, error) { return NewSecretBuffer(0), nil }
+	resync := func(lines string) {
+		rs, err := parseRecipients([]byte(lines))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := own
+		for _, r := range rs {
+			c.AddRecipients(r)
+		}
+		a.syncEntries(config{}, b, c, rs, ACL{}, pass)
+	}
+
+	otherLine, err := ioutil.ReadFile(otherPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resync(string(otherLine))
+	if err := readRevision(other); err != nil {
+		t.Fatalf("revision not readable by the added recipient: %s", err)
+	}
+
+	resync("")
+	if err := readRevision(other); err == nil {
+		t.Fatal("revision still readable by the removed recipient")
+	}
+	if err := readRevision(own); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// The age backend uses X25519 keys as generated by age-keygen
+// (https://age-encryption.org). The public key ("age1...") doubles as
+// fingerprint, the private key file may contain comments as written by
+// age-keygen. The file key is wrapped the same way age wraps it for X25519
+// recipients.
+const (
+	ageCipher = "age"
+
+	stanzaAgeX25519 = "age-x25519"
+
+	ageLabel           = "age-encryption.org/v1/X25519"
+	ageRecipientPrefix = "age"
+	ageIdentityPrefix  = "age-secret-key-"
+)
+
+func init() {
+	RegisterCipher(ageCipher, ageKeys{})
+}
+
+type ageKeys struct{}
+
+func (ageKeys) Describe() string {
+	return "X25519 keys of age, generate them with 'age-keygen -o key.txt' and 'age-keygen -y key.txt > key.pub'. Entries cannot be signed with age keys."
+}
+
+func (ageKeys) ParseRecipient(line []byte) (recipient, string, error) {
+	fields := strings.SplitN(strings.TrimSpace(string(line)), " ", 2)
+	if !strings.HasPrefix(fields[0], ageRecipientPrefix+"1") {
+		return nil, "", errCipherMismatch
+	}
+	comment := ""
+	if len(fields) == 2 {
+		comment = strings.TrimSpace(fields[1])
+	}
+
+	hrp, key, err := bech32Decode(fields[0])
+	if err != nil {
+		return nil, "", fmt.Errorf("age recipient is malformed: %s", err.Error())
+	}
+	if hrp != ageRecipientPrefix || len(key) != 32 {
+		return nil, "", fmt.Errorf("age recipient is malformed")
+	}
+	r := ageRecipient{fingerprint: fields[0]}
+	copy(r.key[:], key)
+	return r, comment, nil
+}
+
+func (ageKeys) ParseIdentity(data, pass []byte) (identity, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(strings.ToLower(line), ageIdentityPrefix+"1") {
+			continue
+		}
+
+		hrp, key, err := bech32Decode(line)
+		if err != nil {
+			return nil, fmt.Errorf("age identity is malformed: %s", err.Error())
+		}
+		if hrp != ageIdentityPrefix || len(key) != 32 {
+			return nil, fmt.Errorf("age identity is malformed")
+		}
+		id := &ageIdentity{}
+		copy(id.key[:], key)
+		wipe(key)
+		curve25519.ScalarBaseMult(&id.publicKey, &id.key)
+		id.fingerprint, err = bech32Encode(ageRecipientPrefix, id.publicKey[:])
+		return id, err
+	}
+	return nil, errCipherMismatch
+}
+
+func (ageKeys) NewSigner(data, pass []byte) (ssh.Signer, error) {
+	return nil, nil
+}
+
+type ageRecipient struct {
+	key         [32]byte
+	fingerprint string
+}
+
+func (r ageRecipient) Wrap(fileKey []byte) (stanza, error) {
+	body, err := x25519Wrap(ageLabel, r.key, fileKey)
+	if err != nil {
+		return stanza{}, err
+	}
+	return stanza{Type: stanzaAgeX25519, Fingerprint: r.fingerprint, Body: body}, nil
+}
+
+func (r ageRecipient) Fingerprint() string {
+	return r.fingerprint
+}
+
+type ageIdentity struct {
+	key         [32]byte
+	publicKey   [32]byte
+	fingerprint string
+}
+
+func (i ageIdentity) Unwrap(s stanza) ([]byte, error) {
+	if s.Type != stanzaAgeX25519 {
+		return nil, errIdentityMismatch
+	}
+	return x25519Unwrap(ageLabel, i.key, i.publicKey, s.Body)
+}
+
+func (i ageIdentity) Fingerprint() string {
+	return i.fingerprint
+}
+
+func (i *ageIdentity) Destroy() {
+	wipe(i.key[:])
+}
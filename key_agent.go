@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// An ssh-agent does not offer any way to decrypt data, it only signs data
+// with the keys it holds. RSA (PKCS#1 v1.5) as well as Ed25519 signatures are
+// deterministic though, the signature over a random nonce can therefore be
+// used to derive a key which wraps the file key. Since creating the stanza
+// requires the agent as well, such a stanza is only added for the key of the
+// user, in addition to the regular one. The stanza body holds the nonce
+// followed by the wrapped file key.
+const (
+	stanzaSSHAgent = "ssh-agent-signature"
+
+	agentLabel     = "scum/ssh-agent"
+	agentNonceSize = 32
+)
+
+// agentKey is a key held by an ssh-agent. It acts as recipient as well as
+// identity.
+type agentKey struct {
+	agent       agent.Agent
+	key         ssh.PublicKey
+	fingerprint string
+}
+
+// dialAgent connects to the ssh-agent listening on $SSH_AUTH_SOCK.
+func dialAgent() (agent.Agent, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("ssh-agent is not available, SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to ssh-agent at %s: %s", socket, err.Error())
+	}
+	return agent.NewClient(conn), nil
+}
+
+// newAgentKey looks up the key with the given fingerprint in the agent.
+func newAgentKey(a agent.Agent, fingerprint string) (agentKey, error) {
+	keys, err := a.List()
+	if err != nil {
+		return agentKey{}, fmt.Errorf("could not list keys of ssh-agent: %s", err.Error())
+	}
+
+	for _, k := range keys {
+		if ssh.FingerprintSHA256(k) != fingerprint {
+			continue
+		}
+		if k.Type() != ssh.KeyAlgoRSA && k.Type() != ssh.KeyAlgoED25519 {
+			return agentKey{}, fmt.Errorf("key %s of type %s cannot be used with ssh-agent, use %s or %s", fingerprint, k.Type(), ssh.KeyAlgoRSA, ssh.KeyAlgoED25519)
+		}
+		return agentKey{agent: a, key: k, fingerprint: fingerprint}, nil
+	}
+	return agentKey{}, fmt.Errorf("key %s is not available in ssh-agent, add it with ssh-add", fingerprint)
+}
+
+func (k agentKey) Wrap(fileKey []byte) (stanza, error) {
+	nonce := make([]byte, agentNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return stanza{}, err
+	}
+
+	aead, err := k.wrappingKey(nonce)
+	if err != nil {
+		return stanza{}, err
+	}
+	wrapped := aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), fileKey, nil)
+
+	return stanza{
+		Type:        stanzaSSHAgent,
+		Fingerprint: k.fingerprint,
+		Body:        append(nonce, wrapped...),
+	}, nil
+}
+
+func (k agentKey) Unwrap(s stanza) ([]byte, error) {
+	if s.Type != stanzaSSHAgent {
+		return nil, errIdentityMismatch
+	}
+	if len(s.Body) < agentNonceSize {
+		return nil, fmt.Errorf("stanza is truncated")
+	}
+
+	aead, err := k.wrappingKey(s.Body[:agentNonceSize])
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), s.Body[agentNonceSize:], nil)
+}
+
+func (k agentKey) Fingerprint() string {
+	return k.fingerprint
+}
+
+// wrappingKey has the agent sign the nonce and derives the wrapping key from
+// the signature.
+func (k agentKey) wrappingKey(nonce []byte) (cipher.AEAD, error) {
+	msg := append([]byte(agentLabel+"\x00"), nonce...)
+	sig, err := k.agent.Sign(k.key, msg)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent could not sign: %s", err.Error())
+	}
+
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sig.Blob, nonce, []byte(agentLabel)), key); err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(key)
+}
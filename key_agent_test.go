@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// testAgentKey adds priv to the keyring and returns it as agentKey.
+func testAgentKey(t *testing.T, keyring agent.Agent, priv interface{}) agentKey {
+	if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := newAgentKey(keyring, ssh.FingerprintSHA256(signer.PublicKey()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestAgentKeyWrapUnwrap(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := agent.NewKeyring()
+	other := testAgentKey(t, keyring, otherKey)
+	for name, priv := range map[string]interface{}{"rsa": rsaKey, "ed25519": edKey} {
+		k := testAgentKey(t, keyring, priv)
+
+		fileKey := make([]byte, 32)
+		if _, err := rand.Read(fileKey); err != nil {
+			t.Fatal(err)
+		}
+		s, err := k.Wrap(fileKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Fingerprint != k.Fingerprint() {
+			t.Fatalf("%s: stanza for %s instead of %s", name, s.Fingerprint, k.Fingerprint())
+		}
+		out, err := k.Unwrap(s)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if !bytes.Equal(out, fileKey) {
+			t.Fatalf("%s: unwrapped file key differs", name)
+		}
+
+		if _, err := other.Unwrap(s); err == nil {
+			t.Fatalf("%s: file key unwrapped with a different key", name)
+		}
+		if _, err := k.Unwrap(stanza{Type: stanzaSSHAgent, Body: s.Body[:agentNonceSize-1]}); err == nil {
+			t.Fatalf("%s: truncated stanza accepted", name)
+		}
+	}
+}
+
+func TestAgentKeyRejectsUnsupportedKeys(t *testing.T) {
+	keyring := agent.NewKeyring()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Add(agent.AddedKey{PrivateKey: ecKey}); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newAgentKey(keyring, ssh.FingerprintSHA256(pub)); err == nil {
+		t.Fatal("ECDSA key accepted")
+	}
+	if _, err := newAgentKey(keyring, "SHA256:missing"); err == nil {
+		t.Fatal("missing key accepted")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// daemonKey is the key of the user held by the scum agent, see daemon.go. It
+// acts as identity, files are encrypted for the key as usual.
+type daemonKey struct {
+	client      daemonClient
+	fingerprint string
+	signerKey   []byte
+}
+
+// newDaemonKey checks that the daemon is unlocked and holds the key with the
+// given fingerprint.
+func newDaemonKey(client daemonClient, fingerprint string) (daemonKey, error) {
+	st, err := client.Status()
+	if err != nil {
+		return daemonKey{}, err
+	}
+	if st.Fingerprint != fingerprint {
+		return daemonKey{}, fmt.Errorf("scum agent holds key %s instead of %s", st.Fingerprint, fingerprint)
+	}
+	if !st.Unlocked {
+		return daemonKey{}, fmt.Errorf("scum agent is locked")
+	}
+	return daemonKey{client: client, fingerprint: fingerprint, signerKey: st.SignerKey}, nil
+}
+
+func (k daemonKey) Unwrap(s stanza) ([]byte, error) {
+	resp, err := k.client.call(daemonRequest{Op: daemonOpUnwrap, Stanza: s})
+	return resp.Data, err
+}
+
+func (k daemonKey) Fingerprint() string {
+	return k.fingerprint
+}
+
+func (k daemonKey) decryptLegacy(payload []byte) ([]byte, error) {
+	resp, err := k.client.call(daemonRequest{Op: daemonOpLegacy, Data: payload})
+	return resp.Data, err
+}
+
+// Signer returns a signer backed by the daemon, or nil if the key is unable
+// to sign.
+func (k daemonKey) Signer() (ssh.Signer, error) {
+	if len(k.signerKey) == 0 {
+		return nil, nil
+	}
+	pub, err := ssh.ParsePublicKey(k.signerKey)
+	if err != nil {
+		return nil, err
+	}
+	return daemonSigner{key: k, pub: pub}, nil
+}
+
+// daemonSigner has the scum agent sign files. The agent only signs the hash
+// of a file in the SSHSIG format of scum, see signSSHSIG, and no other data.
+type daemonSigner struct {
+	key daemonKey
+	pub ssh.PublicKey
+}
+
+func (s daemonSigner) PublicKey() ssh.PublicKey {
+	return s.pub
+}
+
+func (s daemonSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return nil, fmt.Errorf("scum agent only signs files of scum")
+}
+
+func (s daemonSigner) SignSSHSIG(hash []byte) ([]byte, error) {
+	resp, err := s.key.client.call(daemonRequest{Op: daemonOpSign, Data: hash})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("scum agent did not return a signature")
+	}
+	return resp.Data, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/ssh"
+)
+
+// Ed25519 keys cannot be used for encryption directly. Instead they are
+// converted to their X25519 (Montgomery) form and the file key is wrapped
+// with a key derived from an ephemeral Diffie-Hellman exchange, similar to
+// what age (https://age-encryption.org) does.
+const (
+	stanzaEd25519X25519 = "ssh-ed25519-x25519"
+
+	x25519Label = "scum/ssh-ed25519"
+)
+
+func init() {
+	RegisterCipher(ssh.KeyAlgoED25519, sshCipher{
+		keyType:     ssh.KeyAlgoED25519,
+		description: "Ed25519 keys of OpenSSH, converted to X25519 to wrap the file key.",
+	})
+}
+
+type ed25519Recipient struct {
+	key         [32]byte
+	fingerprint string
+}
+
+func newEd25519Recipient(pub ssh.PublicKey) (recipient, error) {
+	cpk, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key of type %s cannot be used for encryption", pub.Type())
+	}
+	key, ok := cpk.CryptoPublicKey().(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key of type %s is not an Ed25519 key", pub.Type())
+	}
+	r := ed25519Recipient{fingerprint: ssh.FingerprintSHA256(pub)}
+	var err error
+	r.key, err = ed25519PublicKeyToCurve25519(key)
+	return r, err
+}
+
+func (r ed25519Recipient) Wrap(fileKey []byte) (stanza, error) {
+	body, err := x25519Wrap(x25519Label, r.key, fileKey)
+	if err != nil {
+		return stanza{}, err
+	}
+	return stanza{Type: stanzaEd25519X25519, Fingerprint: r.fingerprint, Body: body}, nil
+}
+
+func (r ed25519Recipient) Fingerprint() string {
+	return r.fingerprint
+}
+
+type ed25519Identity struct {
+	key         [32]byte
+	publicKey   [32]byte
+	fingerprint string
+}
+
+func newEd25519Identity(key ed25519.PrivateKey) (identity, error) {
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	i := &ed25519Identity{fingerprint: ssh.FingerprintSHA256(pub)}
+	i.key = ed25519PrivateKeyToCurve25519(key)
+	curve25519.ScalarBaseMult(&i.publicKey, &i.key)
+	return i, nil
+}
+
+func (i ed25519Identity) Unwrap(s stanza) ([]byte, error) {
+	if s.Type != stanzaEd25519X25519 {
+		return nil, errIdentityMismatch
+	}
+	return x25519Unwrap(x25519Label, i.key, i.publicKey, s.Body)
+}
+
+func (i ed25519Identity) Fingerprint() string {
+	return i.fingerprint
+}
+
+func (i *ed25519Identity) Destroy() {
+	wipe(i.key[:])
+}
+
+// x25519Wrap wraps the file key for the X25519 public key recipient. The
+// result holds the ephemeral public key followed by the wrapped file key.
+func x25519Wrap(label string, recipient [32]byte, fileKey []byte) ([]byte, error) {
+	var ephemeral, ephemeralShare, shared [32]byte
+	if _, err := rand.Read(ephemeral[:]); err != nil {
+		return nil, err
+	}
+	curve25519.ScalarBaseMult(&ephemeralShare, &ephemeral)
+	curve25519.ScalarMult(&shared, &ephemeral, &recipient)
+
+	aead, err := x25519WrappingKey(label, shared, ephemeralShare, recipient)
+	if err != nil {
+		return nil, err
+	}
+	wrapped := aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), fileKey, nil)
+	return append(ephemeralShare[:], wrapped...), nil
+}
+
+// x25519Unwrap is the inverse of x25519Wrap.
+func x25519Unwrap(label string, key, publicKey [32]byte, body []byte) ([]byte, error) {
+	if len(body) < 32 {
+		return nil, fmt.Errorf("stanza is truncated")
+	}
+
+	var ephemeralShare, shared [32]byte
+	copy(ephemeralShare[:], body[:32])
+	curve25519.ScalarMult(&shared, &key, &ephemeralShare)
+
+	aead, err := x25519WrappingKey(label, shared, ephemeralShare, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), body[32:], nil)
+}
+
+// x25519WrappingKey derives the key used to wrap the file key, label
+// separates the different uses of X25519. Since every wrapping key is used
+// exactly once, a zero nonce is fine.
+func x25519WrappingKey(label string, shared, ephemeralShare, recipient [32]byte) (cipher.AEAD, error) {
+	if shared == [32]byte{} {
+		return nil, fmt.Errorf("invalid X25519 share")
+	}
+
+	salt := append(ephemeralShare[:], recipient[:]...)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared[:], salt, []byte(label)), key); err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(key)
+}
+
+// ed25519PublicKeyToCurve25519 converts the Edwards point y to the
+// Montgomery u-coordinate using u = (1 + y) / (1 - y) mod p as described
+// in RFC 7748.
+func ed25519PublicKeyToCurve25519(pub ed25519.PublicKey) ([32]byte, error) {
+	var out [32]byte
+	if len(pub) != ed25519.PublicKeySize {
+		return out, fmt.Errorf("invalid Ed25519 public key")
+	}
+
+	p := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+	le := make([]byte, len(pub))
+	copy(le, pub)
+	le[31] &= 0x7f
+	y := new(big.Int).SetBytes(reverse(le))
+
+	one := big.NewInt(1)
+	num := new(big.Int).Add(one, y)
+	den := new(big.Int).Sub(one, y)
+	den.Mod(den, p)
+	if den.Sign() == 0 {
+		return out, fmt.Errorf("invalid Ed25519 public key")
+	}
+	u := num.Mul(num, den.ModInverse(den, p))
+	u.Mod(u, p)
+
+	b := u.Bytes()
+	copy(out[32-len(b):], b)
+	copy(out[:], reverse(out[:]))
+	return out, nil
+}
+
+// ed25519PrivateKeyToCurve25519 derives the X25519 scalar from the seed of
+// the Ed25519 key as described in RFC 8032.
+func ed25519PrivateKeyToCurve25519(key ed25519.PrivateKey) [32]byte {
+	var out [32]byte
+	h := sha512.Sum512(key.Seed())
+	copy(out[:], h[:32])
+	out[0] &= 248
+	out[31] &= 127
+	out[31] |= 64
+	return out
+}
+
+func reverse(in []byte) []byte {
+	out := make([]byte, len(in))
+	for i := range in {
+		out[len(in)-1-i] = in[i]
+	}
+	return out
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestEd25519ToCurve25519(t *testing.T) {
+	// RFC 8032, section 7.1, test 1
+	seed, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	keys := []ed25519.PrivateKey{ed25519.NewKeyFromSeed(seed)}
+	for i := 0; i < 32; i++ {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, priv)
+	}
+
+	for _, priv := range keys {
+		scalar := ed25519PrivateKeyToCurve25519(priv)
+		expected, err := curve25519.X25519(scalar[:], curve25519.Basepoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := ed25519PublicKeyToCurve25519(priv.Public().(ed25519.PublicKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pub[:], expected) {
+			t.Fatalf("public key %x converts to %x, the scalar to %x", priv.Public(), pub, expected)
+		}
+	}
+
+	if _, err := ed25519PublicKeyToCurve25519(ed25519.PublicKey{1, 2, 3}); err == nil {
+		t.Fatal("truncated public key accepted")
+	}
+}
+
+func TestEd25519WrapUnwrap(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newEd25519Recipient(sshPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := newEd25519Identity(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Fingerprint() != id.Fingerprint() {
+		t.Fatalf("recipient %s does not match identity %s", r.Fingerprint(), id.Fingerprint())
+	}
+
+	fileKey := make([]byte, 32)
+	if _, err := rand.Read(fileKey); err != nil {
+		t.Fatal(err)
+	}
+	s, err := r.Wrap(fileKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := id.Unwrap(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, fileKey) {
+		t.Fatal("unwrapped file key differs")
+	}
+
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherID, err := newEd25519Identity(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := otherID.Unwrap(s); err == nil {
+		t.Fatal("file key unwrapped with a different key")
+	}
+}
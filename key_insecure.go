@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The insecure backend stores the file key in plain text next to the
+// encrypted data, anybody is thus able to read the entries. It is meant for
+// tests and demos only. Its public and private key files contain nothing but
+// the word "insecure", the public key may be followed by a comment.
+const (
+	insecureCipher = "insecure"
+
+	stanzaInsecure = "insecure"
+)
+
+func init() {
+	RegisterCipher(insecureCipher, insecureKeys{})
+}
+
+type insecureKeys struct{}
+
+func (insecureKeys) Describe() string {
+	return "No encryption at all, for tests and demos only. Both key files contain the word 'insecure'."
+}
+
+func (insecureKeys) ParseRecipient(line []byte) (recipient, string, error) {
+	fields := strings.SplitN(strings.TrimSpace(string(line)), " ", 2)
+	if fields[0] != insecureCipher {
+		return nil, "", errCipherMismatch
+	}
+	comment := ""
+	if len(fields) == 2 {
+		comment = strings.TrimSpace(fields[1])
+	}
+	return insecureKey{}, comment, nil
+}
+
+func (insecureKeys) ParseIdentity(data, pass []byte) (identity, error) {
+	if !bytes.Equal(bytes.TrimSpace(data), []byte(insecureCipher)) {
+		return nil, errCipherMismatch
+	}
+	return insecureKey{}, nil
+}
+
+func (insecureKeys) NewSigner(data, pass []byte) (ssh.Signer, error) {
+	return nil, nil
+}
+
+// insecureKey acts as recipient as well as identity.
+type insecureKey struct{}
+
+func (insecureKey) Wrap(fileKey []byte) (stanza, error) {
+	return stanza{Type: stanzaInsecure, Fingerprint: insecureCipher, Body: fileKey}, nil
+}
+
+func (insecureKey) Unwrap(s stanza) ([]byte, error) {
+	if s.Type != stanzaInsecure {
+		return nil, errIdentityMismatch
+	}
+	return s.Body, nil
+}
+
+func (insecureKey) Fingerprint() string {
+	return insecureCipher
+}
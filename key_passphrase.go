@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/scrypt"
+)
+
+// A passphrase recipient is an X25519 key pair derived from a passphrase
+// using scrypt. Only the scrypt parameters and the public key are stored in
+// the recipients file, entries can therefore be encrypted for it without
+// knowing the passphrase. A line in the recipients file looks like
+//
+//	scum-passphrase <log2(N)>:<salt>:<public key> [comment]
+//
+// The stanza body holds log2(N) (1 byte) and the salt followed by the
+// ephemeral public key and the wrapped file key, the passphrase is thus
+// sufficient to decrypt an entry.
+const (
+	passphraseKeyType = "scum-passphrase"
+	stanzaPassphrase  = "scum-passphrase-x25519"
+
+	passphraseLabel    = "scum/passphrase"
+	passphraseLogN     = 18
+	passphraseMaxLogN  = 22
+	passphraseSaltSize = 16
+)
+
+type passphraseRecipient struct {
+	logN        int
+	salt        []byte
+	key         [32]byte
+	fingerprint string
+}
+
+// newPassphraseRecipient derives a new recipient from the passphrase.
+func newPassphraseRecipient(pass []byte) (passphraseRecipient, error) {
+	r := passphraseRecipient{logN: passphraseLogN, salt: make([]byte, passphraseSaltSize)}
+	if _, err := rand.Read(r.salt); err != nil {
+		return r, err
+	}
+
+	key, pub, err := derivePassphraseKey(pass, r.salt, r.logN)
+	if err != nil {
+		return r, err
+	}
+	key.Destroy()
+	r.key = pub
+	r.fingerprint = passphraseFingerprint(r.key)
+	return r, nil
+}
+
+// parsePassphraseRecipient reads a line of the recipients file.
+func parsePassphraseRecipient(line string) (recipient, string, error) {
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+	if len(fields) < 2 || fields[0] != passphraseKeyType {
+		return nil, "", fmt.Errorf("not a %s recipient", passphraseKeyType)
+	}
+	comment := ""
+	if len(fields) == 3 {
+		comment = strings.TrimSpace(fields[2])
+	}
+
+	params := strings.Split(fields[1], ":")
+	if len(params) != 3 {
+		return nil, "", fmt.Errorf("%s recipient is malformed", passphraseKeyType)
+	}
+
+	r := passphraseRecipient{}
+	var err error
+	r.logN, err = strconv.Atoi(params[0])
+	if err != nil || r.logN < 1 || r.logN > passphraseMaxLogN {
+		return nil, "", fmt.Errorf("%s recipient has invalid work factor '%s'", passphraseKeyType, params[0])
+	}
+	r.salt, err = base64.RawStdEncoding.DecodeString(params[1])
+	if err != nil || len(r.salt) != passphraseSaltSize {
+		return nil, "", fmt.Errorf("%s recipient has invalid salt", passphraseKeyType)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(params[2])
+	if err != nil || len(key) != len(r.key) {
+		return nil, "", fmt.Errorf("%s recipient has invalid public key", passphraseKeyType)
+	}
+	copy(r.key[:], key)
+	r.fingerprint = passphraseFingerprint(r.key)
+
+	return r, comment, nil
+}
+
+// String returns the recipient in the format of the recipients file.
+func (r passphraseRecipient) String() string {
+	return fmt.Sprintf("%s %d:%s:%s", passphraseKeyType, r.logN,
+		base64.RawStdEncoding.EncodeToString(r.salt),
+		base64.RawStdEncoding.EncodeToString(r.key[:]))
+}
+
+func (r passphraseRecipient) Wrap(fileKey []byte) (stanza, error) {
+	body, err := x25519Wrap(passphraseLabel, r.key, fileKey)
+	if err != nil {
+		return stanza{}, err
+	}
+	params := append([]byte{byte(r.logN)}, r.salt...)
+	return stanza{Type: stanzaPassphrase, Fingerprint: r.fingerprint, Body: append(params, body...)}, nil
+}
+
+func (r passphraseRecipient) Fingerprint() string {
+	return r.fingerprint
+}
+
+// passphraseIdentity derives the key pair from the passphrase and the
+// parameters found in the stanza. Since scrypt is slow by design, derived
+// keys are cached in SecretBuffers until Destroy is called, copies of an
+// identity share the cache.
+type passphraseIdentity struct {
+	pass  []byte
+	mu    *sync.Mutex
+	cache map[string]passphraseKey
+}
+
+type passphraseKey struct {
+	key       *SecretBuffer
+	publicKey [32]byte
+}
+
+func newPassphraseIdentity(pass []byte) passphraseIdentity {
+	return passphraseIdentity{pass: pass, mu: &sync.Mutex{}, cache: map[string]passphraseKey{}}
+}
+
+func (i passphraseIdentity) Unwrap(s stanza) ([]byte, error) {
+	if s.Type != stanzaPassphrase {
+		return nil, errIdentityMismatch
+	}
+	if len(s.Body) < 1+passphraseSaltSize {
+		return nil, fmt.Errorf("stanza is truncated")
+	}
+	logN := int(s.Body[0])
+	salt := s.Body[1 : 1+passphraseSaltSize]
+	if logN < 1 || logN > passphraseMaxLogN {
+		return nil, fmt.Errorf("stanza has invalid work factor %d", logN)
+	}
+
+	// the lock is held while the key is used so Destroy cannot wipe it
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	cacheKey := fmt.Sprintf("%x:%d:%x", sha256.Sum256(i.pass), logN, salt)
+	k, ok := i.cache[cacheKey]
+	if !ok {
+		key, pub, err := derivePassphraseKey(i.pass, salt, logN)
+		if err != nil {
+			return nil, err
+		}
+		k = passphraseKey{key: key, publicKey: pub}
+		i.cache[cacheKey] = k
+	}
+
+	if passphraseFingerprint(k.publicKey) != s.Fingerprint {
+		return nil, fmt.Errorf("passphrase is incorrect")
+	}
+	var key [32]byte
+	copy(key[:], k.key.Bytes())
+	defer wipe(key[:])
+	return x25519Unwrap(passphraseLabel, key, k.publicKey, s.Body[1+passphraseSaltSize:])
+}
+
+// Fingerprint is empty since it is only known once the key is derived, the
+// identity is tried on every passphrase stanza.
+func (i passphraseIdentity) Fingerprint() string {
+	return ""
+}
+
+// Destroy wipes all keys derived so far, for all copies of the identity.
+func (i passphraseIdentity) Destroy() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for cacheKey, k := range i.cache {
+		k.key.Destroy()
+		delete(i.cache, cacheKey)
+	}
+}
+
+// derivePassphraseKey returns the private key, which the caller destroys,
+// and the public key derived from the passphrase.
+func derivePassphraseKey(pass, salt []byte, logN int) (*SecretBuffer, [32]byte, error) {
+	var pub [32]byte
+	seed, err := scrypt.Key(pass, salt, 1<<uint(logN), 8, 1, 32)
+	if err != nil {
+		return nil, pub, err
+	}
+	seed[0] &= 248
+	seed[31] &= 127
+	seed[31] |= 64
+	key := NewSecretBufferFrom(seed)
+
+	p, err := curve25519.X25519(key.Bytes(), curve25519.Basepoint)
+	if err != nil {
+		key.Destroy()
+		return nil, pub, err
+	}
+	copy(pub[:], p)
+	return key, pub, nil
+}
+
+func passphraseFingerprint(key [32]byte) string {
+	sum := sha256.Sum256(append([]byte(passphraseKeyType), key[:]...))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
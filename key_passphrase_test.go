@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestPassphraseIdentityDestroy(t *testing.T) {
+	// a low work factor keeps the test fast
+	r := passphraseRecipient{logN: 10, salt: make([]byte, passphraseSaltSize)}
+	if _, err := rand.Read(r.salt); err != nil {
+		t.Fatal(err)
+	}
+	key, pub, err := derivePassphraseKey([]byte("secret"), r.salt, r.logN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Destroy()
+	r.key = pub
+	r.fingerprint = passphraseFingerprint(pub)
+
+	fileKey := make([]byte, 32)
+	if _, err := rand.Read(fileKey); err != nil {
+		t.Fatal(err)
+	}
+	s, err := r.Wrap(fileKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := newPassphraseIdentity([]byte("secret"))
+	got, err := id.Unwrap(s)
+	if err != nil || !bytes.Equal(got, fileKey) {
+		t.Fatalf("file key not unwrapped: %v", err)
+	}
+	if len(id.cache) != 1 {
+		t.Fatalf("expected one cached key, got %d", len(id.cache))
+	}
+	cached := []*SecretBuffer{}
+	for _, k := range id.cache {
+		cached = append(cached, k.key)
+	}
+
+	// copies share the cache, destroying one wipes the keys of all
+	copied := id
+	copied.Destroy()
+	if len(id.cache) != 0 {
+		t.Fatal("cached keys kept after Destroy")
+	}
+	for _, k := range cached {
+		if k.Bytes() != nil {
+			t.Fatal("cached key not wiped")
+		}
+	}
+	if got, err := id.Unwrap(s); err != nil || !bytes.Equal(got, fileKey) {
+		t.Fatalf("file key not unwrapped after Destroy: %v", err)
+	}
+
+	if _, err := newPassphraseIdentity([]byte("wrong")).Unwrap(s); err == nil {
+		t.Fatal("wrong passphrase accepted")
+	}
+}
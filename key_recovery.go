@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// The recovery key is a random X25519 key pair of the bag. Its public key is
+// listed in the recipients file like
+//
+//	scum-recovery <public key> [comment]
+//
+// while the private key is only stored split into shares (see shamir.go), each
+// encrypted for a different recipient. The stanza body holds the ephemeral
+// public key followed by the wrapped file key.
+const (
+	recoveryKeyType = "scum-recovery"
+	stanzaRecovery  = "scum-recovery-x25519"
+
+	recoveryLabel = "scum/recovery"
+)
+
+type recoveryRecipient struct {
+	key         [32]byte
+	fingerprint string
+}
+
+// newRecoveryKey generates a new recovery key pair.
+func newRecoveryKey() (recoveryIdentity, error) {
+	var id recoveryIdentity
+	if _, err := rand.Read(id.key[:]); err != nil {
+		return id, err
+	}
+	return newRecoveryIdentity(id.key[:])
+}
+
+// parseRecoveryRecipient reads a line of the recipients file.
+func parseRecoveryRecipient(line string) (recipient, string, error) {
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+	if len(fields) < 2 || fields[0] != recoveryKeyType {
+		return nil, "", fmt.Errorf("not a %s recipient", recoveryKeyType)
+	}
+	comment := ""
+	if len(fields) == 3 {
+		comment = strings.TrimSpace(fields[2])
+	}
+
+	r := recoveryRecipient{}
+	key, err := base64.RawStdEncoding.DecodeString(fields[1])
+	if err != nil || len(key) != len(r.key) {
+		return nil, "", fmt.Errorf("%s recipient has invalid public key", recoveryKeyType)
+	}
+	copy(r.key[:], key)
+	r.fingerprint = recoveryFingerprint(r.key)
+
+	return r, comment, nil
+}
+
+// String returns the recipient in the format of the recipients file.
+func (r recoveryRecipient) String() string {
+	return fmt.Sprintf("%s %s", recoveryKeyType, base64.RawStdEncoding.EncodeToString(r.key[:]))
+}
+
+func (r recoveryRecipient) Wrap(fileKey []byte) (stanza, error) {
+	body, err := x25519Wrap(recoveryLabel, r.key, fileKey)
+	if err != nil {
+		return stanza{}, err
+	}
+	return stanza{Type: stanzaRecovery, Fingerprint: r.fingerprint, Body: body}, nil
+}
+
+func (r recoveryRecipient) Fingerprint() string {
+	return r.fingerprint
+}
+
+// recoveryIdentity is the reassembled private recovery key.
+type recoveryIdentity struct {
+	key, pub [32]byte
+}
+
+func newRecoveryIdentity(key []byte) (recoveryIdentity, error) {
+	id := recoveryIdentity{}
+	if len(key) != len(id.key) {
+		return id, fmt.Errorf("recovery key has invalid length %d", len(key))
+	}
+	copy(id.key[:], key)
+	curve25519.ScalarBaseMult(&id.pub, &id.key)
+	return id, nil
+}
+
+// Recipient returns the public part of the key.
+func (id recoveryIdentity) Recipient() recoveryRecipient {
+	return recoveryRecipient{key: id.pub, fingerprint: recoveryFingerprint(id.pub)}
+}
+
+func (id recoveryIdentity) Unwrap(s stanza) ([]byte, error) {
+	if s.Type != stanzaRecovery {
+		return nil, errIdentityMismatch
+	}
+	return x25519Unwrap(recoveryLabel, id.key, id.pub, s.Body)
+}
+
+func (id recoveryIdentity) Fingerprint() string {
+	return recoveryFingerprint(id.pub)
+}
+
+func recoveryFingerprint(key [32]byte) string {
+	sum := sha256.Sum256(append([]byte(recoveryKeyType), key[:]...))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
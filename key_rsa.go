@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	stanzaRSAOAEP = "ssh-rsa-oaep-sha256"
+
+	oaepLabel = "scum file"
+)
+
+func init() {
+	RegisterCipher(ssh.KeyAlgoRSA, sshCipher{
+		keyType:     ssh.KeyAlgoRSA,
+		description: "RSA keys of OpenSSH, the file key is wrapped with RSA-OAEP/SHA-256.",
+	})
+}
+
+// rsaRecipient wraps the file key with RSA-OAEP/SHA-256.
+type rsaRecipient struct {
+	key         *rsa.PublicKey
+	fingerprint string
+}
+
+func newRSARecipient(pub ssh.PublicKey) (recipient, error) {
+	cpk, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key of type %s cannot be used for encryption", pub.Type())
+	}
+	key, ok := cpk.CryptoPublicKey().(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key of type %s is not an RSA key", pub.Type())
+	}
+	return rsaRecipient{key: key, fingerprint: ssh.FingerprintSHA256(pub)}, nil
+}
+
+func (r rsaRecipient) Wrap(fileKey []byte) (stanza, error) {
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, r.key, fileKey, []byte(oaepLabel))
+	if err != nil {
+		return stanza{}, err
+	}
+	return stanza{Type: stanzaRSAOAEP, Fingerprint: r.fingerprint, Body: wrapped}, nil
+}
+
+func (r rsaRecipient) Fingerprint() string {
+	return r.fingerprint
+}
+
+type rsaIdentity struct {
+	key         *rsa.PrivateKey
+	fingerprint string
+}
+
+func newRSAIdentity(key *rsa.PrivateKey) (identity, error) {
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return rsaIdentity{key: key, fingerprint: ssh.FingerprintSHA256(pub)}, nil
+}
+
+func (i rsaIdentity) Unwrap(s stanza) ([]byte, error) {
+	if s.Type != stanzaRSAOAEP {
+		return nil, errIdentityMismatch
+	}
+	return rsa.DecryptOAEP(sha256.New(), rand.Reader, i.key, s.Body, []byte(oaepLabel))
+}
+
+func (i rsaIdentity) Fingerprint() string {
+	return i.fingerprint
+}
+
+func (i rsaIdentity) Destroy() {
+	wipePrivateKey(i.key)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshCipher is the backend for SSH keys of a single type. Private keys are
+// read the same way for all types, a key pair may thus be migrated from one
+// type to another with 'scum rekey'.
+type sshCipher struct {
+	keyType     string
+	description string
+}
+
+func (c sshCipher) Describe() string {
+	return c.description
+}
+
+func (c sshCipher) ParseRecipient(line []byte) (recipient, string, error) {
+	if !bytes.Contains(line, []byte(c.keyType+" ")) {
+		return nil, "", errCipherMismatch
+	}
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey(line)
+	if err != nil {
+		return nil, "", err
+	}
+	if pub.Type() != c.keyType {
+		return nil, "", errCipherMismatch
+	}
+
+	switch pub.Type() {
+	case ssh.KeyAlgoRSA:
+		r, err := newRSARecipient(pub)
+		return r, comment, err
+	case ssh.KeyAlgoED25519:
+		r, err := newEd25519Recipient(pub)
+		return r, comment, err
+	default:
+		return nil, "", errCipherMismatch
+	}
+}
+
+func (c sshCipher) ParseIdentity(data, pass []byte) (identity, error) {
+	priv, err := parseSSHPrivateKey(data, pass)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newIdentity(priv)
+	// an RSA identity holds on to the key, Ed25519 keys are converted
+	if _, ok := priv.(*rsa.PrivateKey); !ok {
+		wipePrivateKey(priv)
+	}
+	return id, err
+}
+
+func (c sshCipher) NewSigner(data, pass []byte) (ssh.Signer, error) {
+	priv, err := parseSSHPrivateKey(data, pass)
+	if err != nil {
+		return nil, err
+	}
+	return newSSHSigner(priv)
+}
+
+// newSSHSigner returns a signer for priv which wipes it when destroyed.
+func newSSHSigner(priv interface{}) (ssh.Signer, error) {
+	if k, ok := priv.(*ed25519.PrivateKey); ok {
+		priv = *k
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		wipePrivateKey(priv)
+		return nil, err
+	}
+	as, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return signer, nil
+	}
+	return sshSigner{AlgorithmSigner: as, priv: priv}, nil
+}
+
+// sshSigner is a signer which is able to wipe its private key.
+type sshSigner struct {
+	ssh.AlgorithmSigner
+	priv interface{}
+}
+
+func (s sshSigner) Destroy() {
+	wipePrivateKey(s.priv)
+}
+
+// wipePrivateKey overwrites the secret parts of a private key parsed by
+// parseSSHPrivateKey, the key is unusable afterwards. This is best effort,
+// copies made by the crypto libraries are out of reach.
+func wipePrivateKey(priv interface{}) {
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		wipeInt(k.D)
+		for _, p := range k.Primes {
+			wipeInt(p)
+		}
+		wipeInt(k.Precomputed.Dp)
+		wipeInt(k.Precomputed.Dq)
+		wipeInt(k.Precomputed.Qinv)
+		for _, v := range k.Precomputed.CRTValues {
+			wipeInt(v.Exp)
+			wipeInt(v.Coeff)
+			wipeInt(v.R)
+		}
+	case *ed25519.PrivateKey:
+		wipe(*k)
+	case ed25519.PrivateKey:
+		wipe(k)
+	}
+}
+
+// wipeInt overwrites the words of x in place, unlike setting it to zero.
+func wipeInt(x *big.Int) {
+	if x == nil {
+		return
+	}
+	words := x.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+}
+
+// newIdentity returns the identity matching the type of the private key.
+func newIdentity(priv interface{}) (identity, error) {
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		return newRSAIdentity(k)
+	case *ed25519.PrivateKey:
+		return newEd25519Identity(*k)
+	case ed25519.PrivateKey:
+		return newEd25519Identity(k)
+	default:
+		return nil, fmt.Errorf("private key of type %T is not supported, use an RSA or Ed25519 key", priv)
+	}
+}
+
+// parseSSHPrivateKey decrypts and parses a private key. RSA and Ed25519 keys
+// in the OpenSSH format, as PKCS#1 (RSA only) or PKCS#8 are supported, each
+// of them in their encrypted or unencrypted form.
+func parseSSHPrivateKey(data, password []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errCipherMismatch
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		key, err = ssh.ParseRawPrivateKey(data)
+		if _, ok := err.(*ssh.PassphraseMissingError); ok {
+			key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, password)
+		}
+	case "RSA PRIVATE KEY":
+		b := block.Bytes
+		if x509.IsEncryptedPEMBlock(block) {
+			b, err = x509.DecryptPEMBlock(block, password)
+			if err != nil {
+				break
+			}
+			defer wipe(b)
+		}
+		key, err = x509.ParsePKCS1PrivateKey(b)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		var b []byte
+		b, err = decryptPKCS8(block.Bytes, password)
+		if err != nil {
+			break
+		}
+		defer wipe(b)
+		key, err = x509.ParsePKCS8PrivateKey(b)
+	default:
+		return nil, fmt.Errorf("private key of type '%s' is not supported, use an RSA or Ed25519 key in the OpenSSH, PKCS#1 or PKCS#8 format", block.Type)
+	}
+
+	if err == x509.IncorrectPasswordError {
+		return nil, fmt.Errorf("private key could not be decrypted, is the passphrase correct?")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("private key could not be parsed: %s", err.Error())
+	}
+	return key, nil
+}
@@ -0,0 +1,123 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// The passphrase of the private key may be cached in the session keyring of
+// the kernel (see keyrings(7)), it is then readable by all processes of the
+// login session but not by other processes of the user. Processes without a
+// session keyring use the user session keyring instead. The kernel removes
+// the key once its timeout expires.
+const keyringSupported = true
+
+const (
+	keySpecSessionKeyring = -3
+
+	keyctlGetKeyringID = 0
+	keyctlSearch       = 10
+	keyctlRead         = 11
+	keyctlSetTimeout   = 15
+	keyctlInvalidate   = 21
+
+	keyringKeyType = "user"
+)
+
+// keyctl calls keyctl(2) with arguments which are not pointers, pointers
+// must be converted in the argument list of syscall.Syscall6 itself.
+func keyctl(cmd int, arg2, arg3 uintptr) (uintptr, error) {
+	r, _, errno := syscall.Syscall6(syscall.SYS_KEYCTL, uintptr(cmd), arg2, arg3, 0, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return r, nil
+}
+
+// keyringSearch returns the id of the key desc in the session keyring.
+func keyringSearch(desc string) (uintptr, error) {
+	t, err := syscall.BytePtrFromString(keyringKeyType)
+	if err != nil {
+		return 0, err
+	}
+	d, err := syscall.BytePtrFromString(desc)
+	if err != nil {
+		return 0, err
+	}
+	ring := keySpecSessionKeyring
+	id, _, errno := syscall.Syscall6(syscall.SYS_KEYCTL, keyctlSearch, uintptr(ring), uintptr(unsafe.Pointer(t)), uintptr(unsafe.Pointer(d)), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return id, nil
+}
+
+// keyringGet returns the data stored as desc, or nil if there is none.
+func keyringGet(desc string) (*SecretBuffer, error) {
+	id, err := keyringSearch(desc)
+	if err == syscall.ENOKEY || err == syscall.EKEYEXPIRED || err == syscall.EKEYREVOKED {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	size, _, errno := syscall.Syscall6(syscall.SYS_KEYCTL, keyctlRead, id, 0, 0, 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	s := NewSecretBuffer(int(size))
+	if size == 0 {
+		return s, nil
+	}
+	_, _, errno = syscall.Syscall6(syscall.SYS_KEYCTL, keyctlRead, id, uintptr(unsafe.Pointer(&s.Bytes()[0])), size, 0, 0)
+	if errno != 0 {
+		s.Destroy()
+		return nil, errno
+	}
+	return s, nil
+}
+
+// keyringSet stores data as desc, the key is removed after ttl seconds.
+func keyringSet(desc string, data []byte, ttl int) error {
+	t, err := syscall.BytePtrFromString(keyringKeyType)
+	if err != nil {
+		return err
+	}
+	d, err := syscall.BytePtrFromString(desc)
+	if err != nil {
+		return err
+	}
+	var payload *byte
+	if len(data) > 0 {
+		payload = &data[0]
+	}
+
+	// add_key(2) would create a new session keyring only known to this
+	// process if there is none, look it up without creating it instead
+	spec := keySpecSessionKeyring
+	ring, err := keyctl(keyctlGetKeyringID, uintptr(spec), 0)
+	if err != nil {
+		return err
+	}
+	id, _, errno := syscall.Syscall6(syscall.SYS_ADD_KEY, uintptr(unsafe.Pointer(t)), uintptr(unsafe.Pointer(d)), uintptr(unsafe.Pointer(payload)), uintptr(len(data)), ring, 0)
+	if errno != 0 {
+		return errno
+	}
+	_, err = keyctl(keyctlSetTimeout, id, uintptr(ttl))
+	return err
+}
+
+// keyringForget removes the key desc, it reports whether there was one.
+func keyringForget(desc string) (bool, error) {
+	id, err := keyringSearch(desc)
+	if err == syscall.ENOKEY || err == syscall.EKEYEXPIRED || err == syscall.EKEYREVOKED {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	_, err = keyctl(keyctlInvalidate, id, 0)
+	return err == nil, err
+}
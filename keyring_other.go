@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "fmt"
+
+// The kernel keyring is only available on Linux, see keyring_linux.go.
+const keyringSupported = false
+
+var errKeyringUnsupported = fmt.Errorf("the kernel keyring is only supported on Linux")
+
+func keyringGet(desc string) (*SecretBuffer, error) {
+	return nil, errKeyringUnsupported
+}
+
+func keyringSet(desc string, data []byte, ttl int) error {
+	return errKeyringUnsupported
+}
+
+func keyringForget(desc string) (bool, error) {
+	return false, errKeyringUnsupported
+}
@@ -23,9 +23,9 @@ func exitOnErr(err error) {
 	}
 }
 
-func promptPassword(message string, out io.Writer) ([]byte, error) {
+func promptPassword(message string, out io.Writer) (*SecretBuffer, error) {
 	fmt.Fprintf(out, "Enter Password for '%s': ", message)
 	pw, err := terminal.ReadPassword(int(syscall.Stdin))
 	fmt.Println("")
-	return pw, err
+	return NewSecretBufferFrom(pw), err
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+)
+
+// manifestFile lists the names and types of the entries of a bag which hides
+// them, see 'scum hide'. The entries of such a bag are stored in files named
+// by random IDs instead of '<type>_<name>'. The manifest is encrypted for all
+// recipients of the bag regardless of the acl, everybody able to read it
+// therefore learns the names of all entries.
+const manifestFile = ".manifest"
+
+// manifestIDRegexp matches the IDs assigned by add, the IDs are used as file
+// names and must not be able to point anywhere else.
+var manifestIDRegexp = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+type manifestEntry struct {
+	Name string `yaml:"name"`
+	Kind string `yaml:"type"`
+}
+
+// manifest maps the IDs of the entries of a bag to their names and types.
+type manifest struct {
+	Entries map[string]manifestEntry `yaml:"entries"`
+}
+
+func newManifest() *manifest {
+	return &manifest{Entries: map[string]manifestEntry{}}
+}
+
+// manifestAssociatedData is bound to the encrypted manifest so it cannot be
+// swapped with an entry.
+func manifestAssociatedData() []byte {
+	return []byte("scum manifest")
+}
+
+// decryptManifest is the inverse of encryptManifest.
+func decryptManifest(c Crypt, data, pass []byte) (*manifest, error) {
+	plain, err := c.Decrypt(data, manifestAssociatedData(), pass)
+	if err != nil {
+		return nil, err
+	}
+	defer plain.Destroy()
+
+	m := newManifest()
+	if err := yaml.Unmarshal(plain.Bytes(), m); err != nil {
+		return nil, err
+	}
+	if m.Entries == nil {
+		m.Entries = map[string]manifestEntry{}
+	}
+	for id := range m.Entries {
+		if !manifestIDRegexp.MatchString(id) {
+			return nil, fmt.Errorf("manifest contains invalid entry ID '%s'", id)
+		}
+	}
+	return m, nil
+}
+
+func encryptManifest(c Crypt, m *manifest) ([]byte, error) {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return c.Encrypt(data, manifestAssociatedData())
+}
+
+// lookup returns the ID of the entry name of type kind.
+func (m *manifest) lookup(name, kind string) (string, bool) {
+	for id, e := range m.Entries {
+		if e.Name == name && e.Kind == kind {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// add returns the ID of the entry name of type kind, a new one is assigned
+// if there is no such entry yet.
+func (m *manifest) add(name, kind string) (string, error) {
+	if id, ok := m.lookup(name, kind); ok {
+		return id, nil
+	}
+	for {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("could not generate entry ID: %s", err.Error())
+		}
+		id := hex.EncodeToString(b)
+		if _, taken := m.Entries[id]; !taken {
+			m.Entries[id] = manifestEntry{Name: name, Kind: kind}
+			return id, nil
+		}
+	}
+}
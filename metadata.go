@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The metadata of an entry is kept in a file of the same name in the
+// directory metaDir of the bag. It is encrypted for the same recipients as
+// the entry unless the option 'metadata' of the configuration is set to
+// 'plain', plain metadata can be listed without the passphrase.
+const (
+	metaDir = ".meta"
+
+	metadataEncrypted = "encrypted"
+	metadataPlain     = "plain"
+)
+
+// Metadata is kept up to date by the commands changing or verifying the
+// entry.
+type Metadata struct {
+	Created     time.Time `yaml:"created,omitempty"`
+	Updated     time.Time `yaml:"updated,omitempty"`
+	RotatedAt   time.Time `yaml:"rotated_at,omitempty"`
+	VerifiedAt  time.Time `yaml:"verified_at,omitempty"`
+	Description string    `yaml:"description,omitempty"`
+	Owner       string    `yaml:"owner,omitempty"`
+
+	Tags map[string]string `yaml:"tags,omitempty"`
+}
+
+func (m Metadata) String() string {
+	out := []string{}
+	add := func(key, value string) {
+		if value != "" {
+			out = append(out, fmt.Sprintf("%s: %s", key, value))
+		}
+	}
+	date := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Local().Format("2006-01-02 15:04")
+	}
+	add("tags", formatTags(m.Tags))
+	add("owner", m.Owner)
+	add("description", m.Description)
+	add("created", date(m.Created))
+	add("updated", date(m.Updated))
+	add("rotated", date(m.RotatedAt))
+	add("verified", date(m.VerifiedAt))
+	return strings.Join(out, ", ")
+}
+
+// metaNow returns the current time as stored in the metadata.
+func metaNow() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// metaAssociatedData binds encrypted metadata to its entry.
+func metaAssociatedData(name, kind string) []byte {
+	return []byte("scum metadata\x00" + kind + "\x00" + name)
+}
+
+// metaIsPlain tells plain metadata from an envelope.
+func metaIsPlain(data []byte) bool {
+	return !bytes.HasPrefix(data, []byte(envelopeMagic))
+}
+
+// encodeMeta serializes the metadata of the entry name of type kind, it is
+// encrypted with c unless plain is set.
+func encodeMeta(c Crypt, m Metadata, name, kind string, plain bool) ([]byte, error) {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if plain {
+		return data, nil
+	}
+	return c.Encrypt(data, metaAssociatedData(name, kind))
+}
+
+// decodeMeta is the inverse of encodeMeta, c and pass are only used for
+// encrypted metadata.
+func decodeMeta(c Crypt, data []byte, name, kind string, pass []byte) (Metadata, error) {
+	m := Metadata{}
+	if metaIsPlain(data) {
+		err := yaml.Unmarshal(data, &m)
+		return m, err
+	}
+
+	plain, err := c.Decrypt(data, metaAssociatedData(name, kind), pass)
+	if err != nil {
+		return m, err
+	}
+	defer plain.Destroy()
+	err = yaml.Unmarshal(plain.Bytes(), &m)
+	return m, err
+}
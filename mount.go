@@ -11,9 +11,12 @@ import (
 	"github.com/hanwen/go-fuse/v2/fuse"
 )
 
+// RootFS serves the files in data straight from the SecretBuffers. The
+// snippets they were assembled from are Go strings built from the fields of
+// the profiles, which cannot be wiped and stay on the heap until collected.
 type RootFS struct {
 	fs.Inode
-	data map[string][]byte
+	data map[string]*SecretBuffer
 }
 
 func (r *RootFS) OnAdd(ctx context.Context) {
@@ -21,7 +24,7 @@ func (r *RootFS) OnAdd(ctx context.Context) {
 	for filename, data := range r.data {
 		ch := r.NewPersistentInode(
 			ctx, &fs.MemRegularFile{
-				Data: data,
+				Data: data.Bytes(),
 				Attr: fuse.Attr{
 					Mode: 0600,
 				},
@@ -39,7 +42,15 @@ func (r *RootFS) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOu
 var _ = (fs.NodeGetattrer)((*RootFS)(nil))
 var _ = (fs.NodeOnAdder)((*RootFS)(nil))
 
-func mount(mountpoint string, data map[string][]byte, timeout int, debug bool) {
+// mount serves data at mountpoint until the timeout expires, the buffers are
+// destroyed afterwards.
+func mount(mountpoint string, data map[string]*SecretBuffer, timeout int, debug bool) {
+	defer func() {
+		for _, d := range data {
+			d.Destroy()
+		}
+	}()
+
 	opts := &fs.Options{}
 	opts.Debug = debug
 	server, err := fs.Mount(mountpoint, &RootFS{data: data}, opts)
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Entries can be organized in folders by using '/' in their names, e.g.
+// 'clients/acme/aws-prod'. The entry is stored as 'aws_aws-prod' in the
+// directory 'clients/acme' of the bag.
+
+const nameFolderSeparator = "/"
+
+// checkEntryName rejects names which cannot be stored in a bag.
+func checkEntryName(name string) error {
+	if name == "" {
+		return fmt.Errorf("the name of an entry must not be empty")
+	}
+	for _, seg := range strings.Split(name, nameFolderSeparator) {
+		// hidden files and directories hold information about the bag
+		if seg == "" || strings.HasPrefix(seg, ".") {
+			return fmt.Errorf("invalid entry name '%s': folders and names must neither be empty nor start with '.'", name)
+		}
+	}
+	return nil
+}
+
+// isPathFilter tells filters which are globs on the path of an entry from
+// regular expressions matched against its name, the only filters of bags
+// without folders. '**' is no valid regular expression anyway.
+func isPathFilter(filter string) bool {
+	return strings.Contains(filter, nameFolderSeparator) || strings.Contains(filter, "**")
+}
+
+// globRegexp translates a glob on entry paths into a regular expression, '*'
+// and '?' match within a folder and '**' matches any number of folders. A
+// path without wildcards matches everything below the folder it names as
+// well.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	glob = strings.TrimSuffix(glob, nameFolderSeparator)
+
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			re.WriteString("[^/]*")
+		case glob[i] == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	if !strings.ContainsAny(glob, "*?") {
+		re.WriteString("(/.*)?")
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+// filterRegexp returns the regular expression entry names are matched
+// against for a filter, a glob or a regular expression as it is.
+func filterRegexp(filter string) (*regexp.Regexp, error) {
+	if isPathFilter(filter) {
+		return globRegexp(filter)
+	}
+	return regexp.Compile(filter)
+}
+
+// matchFilter reports whether the entry name matches a filter given on the
+// command line.
+func matchFilter(filter, name string) bool {
+	re, err := filterRegexp(filter)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(name)
+}
+
+// folders splits the name of an entry into its folders and its base name.
+func folders(name string) ([]string, string) {
+	seg := strings.Split(name, nameFolderSeparator)
+	return seg[:len(seg)-1], seg[len(seg)-1]
+}
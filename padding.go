@@ -0,0 +1,96 @@
+package main
+
+import "fmt"
+
+// Data is padded before it is encrypted, so the size of a file only reveals
+// the bucket the size of the secret falls into. The padding consists of a
+// single 0x80 byte followed by zeros (as in ISO/IEC 7816-4). Whether a file is
+// padded is recorded in its header and bound to the payload through the
+// associated data, see paddedAssociatedData.
+//
+// The buckets are configured by the options 'padding' and 'padding_block':
+// with 'pow2' data is padded to the next power of two times the block size,
+// with 'block' to the next multiple of the block size.
+const (
+	paddingNone  = "none"
+	paddingPow2  = "pow2"
+	paddingBlock = "block"
+
+	paddingMarker = 0x80
+)
+
+type padding struct {
+	Policy string
+	Block  int
+}
+
+func newPadding(policy string, block int) (padding, error) {
+	switch policy {
+	case paddingNone, paddingPow2, paddingBlock:
+	default:
+		return padding{}, fmt.Errorf("padding must be one of '%s', '%s' or '%s', not '%s'", paddingNone, paddingPow2, paddingBlock, policy)
+	}
+	if block < 1 {
+		return padding{}, fmt.Errorf("padding_block must be at least 1, not %d", block)
+	}
+	return padding{Policy: policy, Block: block}, nil
+}
+
+// enabled reports whether data is padded at all, the zero value does not pad.
+func (p padding) enabled() bool {
+	return p.Block > 0 && (p.Policy == paddingPow2 || p.Policy == paddingBlock)
+}
+
+// size returns the size of n bytes of data once padded, there is always room
+// for the marker.
+func (p padding) size(n int) int {
+	switch p.Policy {
+	case paddingPow2:
+		size := p.Block
+		for size < n+1 {
+			size *= 2
+		}
+		return size
+	case paddingBlock:
+		return (n/p.Block + 1) * p.Block
+	}
+	return n
+}
+
+// isBucket reports whether size is one of the sizes data is padded to.
+func (p padding) isBucket(size int) bool {
+	return size > 0 && p.size(size-1) == size
+}
+
+// pad returns a copy of data padded to size.
+func pad(data []byte, size int) *SecretBuffer {
+	out := NewSecretBuffer(size)
+	copy(out.Bytes(), data)
+	out.Bytes()[len(data)] = paddingMarker
+	return out
+}
+
+// unpad returns a copy of data without the padding, data is destroyed.
+func unpad(data *SecretBuffer) (*SecretBuffer, error) {
+	defer data.Destroy()
+
+	b := data.Bytes()
+	i := len(b) - 1
+	for i >= 0 && b[i] == 0 {
+		i--
+	}
+	if i < 0 || b[i] != paddingMarker {
+		return nil, fmt.Errorf("padding of the file is malformed")
+	}
+	out := NewSecretBuffer(i)
+	copy(out.Bytes(), b[:i])
+	return out, nil
+}
+
+// paddedAssociatedData extends the associated data of a padded payload, so
+// the padding flag of the header cannot be changed.
+func paddedAssociatedData(ad []byte) []byte {
+	out := make([]byte, 0, len(ad)+len("\x00padded"))
+	out = append(out, ad...)
+	return append(out, "\x00padded"...)
+}
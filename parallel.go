@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// parallel calls fn for every i in [0, n), at most workers calls run at the
+// same time. Callers keep the results in a slice indexed by i so that they
+// can be reported in a stable order.
+func parallel(n, workers int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// sortedNames returns the names of the entries of list in alphabetical order.
+func sortedNames(list map[string]string) []string {
+	names := []string{}
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
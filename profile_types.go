@@ -62,7 +62,10 @@ type Profile interface {
 	Capabilities() ProfileCapabilities
 	Prompt() error
 	Serialize() ([]byte, error)
-	Deserialize([]byte) error
+	// Deserialize reads the profile from decrypted data, the caller
+	// destroys the buffer afterwards. The fields of the profile are
+	// copies which are not wiped.
+	Deserialize(*SecretBuffer) error
 	SetName(string)
 	Name() string
 	String() string
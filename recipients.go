@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// recipientsFile lists the public keys (in the authorized_keys format) of
+// everybody who should be able to read the entries of a bag. It lives in the
+// root of the bag so it can be shared along with the entries.
+const recipientsFile = ".recipients"
+
+// bagRecipient is a recipient listed in the recipients file of a bag, the
+// comment of the key usually names its owner.
+type bagRecipient struct {
+	recipient
+	Comment string
+	Line    string
+}
+
+// parseRecipients reads public keys in the authorized_keys format, empty lines
+// and lines starting with '#' are ignored.
+func parseRecipients(data []byte) ([]bagRecipient, error) {
+	out := []bagRecipient{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, comment, err := parseRecipient([]byte(line))
+		if err != nil {
+			return out, fmt.Errorf("line %d: %s", n, err.Error())
+		}
+		out = append(out, bagRecipient{recipient: r, Comment: comment, Line: line})
+	}
+	return out, scanner.Err()
+}
+
+// formatRecipients is the inverse of parseRecipients.
+func formatRecipients(rs []bagRecipient) []byte {
+	var out bytes.Buffer
+	for _, r := range rs {
+		out.WriteString(r.Line)
+		out.WriteString("\n")
+	}
+	return out.Bytes()
+}
+
+// uniqueRecipients drops every recipient with a fingerprint seen before.
+func uniqueRecipients(rs []recipient) []recipient {
+	seen := map[string]bool{}
+	out := []recipient{}
+	for _, r := range rs {
+		if seen[r.Fingerprint()] {
+			continue
+		}
+		seen[r.Fingerprint()] = true
+		out = append(out, r)
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// recoveryFile lives in the root of the bag and holds the shares of the
+// recovery key (see key_recovery.go), each encrypted for its holder:
+//
+//	# any 2 of the holders are able to recover the bag
+//	fingerprint: SHA256:Xq3cA1...
+//	threshold: 2
+//	shares:
+//	  - holder: SHA256:4f0Bx3...
+//	    comment: alice@example.com
+//	    share: U0NVTQIBAAAA...
+//
+// To recover the bag, every participant decrypts their share and encrypts it
+// for the person doing the recovery, collecting the shares in a file which is
+// passed along (see shareFile).
+const recoveryFile = ".recovery"
+
+type recoveryConfig struct {
+	Fingerprint string          `yaml:"fingerprint"`
+	Threshold   int             `yaml:"threshold"`
+	Shares      []recoveryShare `yaml:"shares"`
+}
+
+// recoveryShare is a share of the recovery key encrypted for the recipient
+// with the fingerprint Holder.
+type recoveryShare struct {
+	Holder  string `yaml:"holder"`
+	Comment string `yaml:"comment"`
+	Share   string `yaml:"share"`
+}
+
+// shareAssociatedData binds encrypted shares to their purpose.
+var shareAssociatedData = []byte("scum recovery share")
+
+// shareFile collects the shares of the participants of a recovery, all of
+// them encrypted for the recipient with the fingerprint For.
+type shareFile struct {
+	Recovery string          `yaml:"recovery"`
+	For      string          `yaml:"for"`
+	Shares   []recoveryShare `yaml:"shares"`
+}
+
+// Share returns the share held by the recipient with the fingerprint holder.
+func (rc recoveryConfig) Share(holder string) (recoveryShare, bool) {
+	for _, s := range rc.Shares {
+		if s.Holder == holder {
+			return s, true
+		}
+	}
+	return recoveryShare{}, false
+}
+
+// encryptShare encrypts a share of the recovery key for r alone.
+func encryptShare(r recipient, share []byte) (string, error) {
+	c := Crypt{self: r, recipients: []recipient{r}}
+	encrypted, err := c.Encrypt(share, shareAssociatedData)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// decryptShare is the inverse of encryptShare.
+func decryptShare(c Crypt, share string, pass []byte) (*SecretBuffer, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(share)
+	if err != nil {
+		return nil, fmt.Errorf("share is malformed: %s", err.Error())
+	}
+	// shares are not signed, they are protected by the recovery fingerprint
+	return c.Unverified().Decrypt(encrypted, shareAssociatedData, pass)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDecryptShareSkipsSignatures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pub, priv := testKeyPair(t, dir, "own")
+	c, err := NewCrypt("", pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.TrustSigners([]string{"SHA256:other"}, true)
+
+	share, err := encryptShare(c.self, []byte("share"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing must be printed for the unsigned share
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	out, err := decryptShare(c, share, []byte{})
+	os.Stderr = stderr
+	w.Close()
+	warnings, _ := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Destroy()
+	if string(out.Bytes()) != "share" {
+		t.Fatalf("unexpected share %q", out.Bytes())
+	}
+	if len(warnings) > 0 {
+		t.Errorf("unexpected warning: %s", warnings)
+	}
+
+	// the trusted signers of c still apply to everything else
+	unsigned, err := c.Encrypt([]byte("secret"), entryAssociatedData("prod", "aws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Decrypt(unsigned, entryAssociatedData("prod", "aws"), []byte{}); err == nil {
+		t.Fatal("unsigned entry accepted after decrypting a share")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+// SecretBuffer holds sensitive data like passphrases and decrypted entries.
+// Its memory is allocated outside of the Go heap, so the garbage collector
+// never copies it around, and where supported it is locked into RAM (it never
+// ends up in swap) and excluded from core dumps. Destroy wipes the data, it
+// should be called as soon as the data is not needed anymore.
+//
+// Locking memory is best effort: the amount of locked memory is limited by
+// RLIMIT_MEMLOCK, a buffer exceeding the limit is still wiped.
+type SecretBuffer struct {
+	data   []byte
+	mapped bool
+}
+
+// NewSecretBuffer allocates a zeroed buffer of size bytes.
+func NewSecretBuffer(size int) *SecretBuffer {
+	data, mapped := allocSecret(size)
+	return &SecretBuffer{data: data, mapped: mapped}
+}
+
+// NewSecretBufferFrom moves data into a new buffer, data is wiped.
+func NewSecretBufferFrom(data []byte) *SecretBuffer {
+	s := NewSecretBuffer(len(data))
+	copy(s.data, data)
+	wipe(data)
+	return s
+}
+
+// Bytes returns the data of the buffer, the slice becomes invalid once the
+// buffer is destroyed.
+func (s *SecretBuffer) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.data
+}
+
+// Len returns the size of the buffer, a nil buffer is empty.
+func (s *SecretBuffer) Len() int {
+	return len(s.Bytes())
+}
+
+// Append returns a new buffer holding the data of s followed by data, s is
+// destroyed. s may be nil.
+func (s *SecretBuffer) Append(data []byte) *SecretBuffer {
+	out := NewSecretBuffer(s.Len() + len(data))
+	copy(out.data, s.Bytes())
+	copy(out.data[s.Len():], data)
+	s.Destroy()
+	return out
+}
+
+// Destroy wipes and releases the buffer, it is safe to call it more than
+// once or on a nil buffer.
+func (s *SecretBuffer) Destroy() {
+	if s == nil || s.data == nil {
+		return
+	}
+	wipe(s.data)
+	freeSecret(s.data, s.mapped)
+	s.data = nil
+}
+
+// wipe overwrites b with zeros.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,35 @@
+//go:build linux
+// +build linux
+
+package main
+
+import "syscall"
+
+// madvDontDump excludes memory from core dumps, package syscall does not
+// define it on all architectures.
+const madvDontDump = 0x10
+
+// allocSecret maps anonymous memory for a SecretBuffer, plain heap memory is
+// used if this fails.
+func allocSecret(size int) ([]byte, bool) {
+	if size == 0 {
+		return []byte{}, false
+	}
+	mem, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return make([]byte, size), false
+	}
+
+	// both are best effort, see SecretBuffer
+	_ = syscall.Mlock(mem)
+	_ = syscall.Madvise(mem, madvDontDump)
+	return mem, true
+}
+
+func freeSecret(mem []byte, mapped bool) {
+	if !mapped {
+		return
+	}
+	_ = syscall.Munlock(mem)
+	_ = syscall.Munmap(mem)
+}
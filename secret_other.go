@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// allocSecret uses plain heap memory on systems other than Linux, the data is
+// still wiped when the SecretBuffer is destroyed.
+func allocSecret(size int) ([]byte, bool) {
+	return make([]byte, size), false
+}
+
+func freeSecret(mem []byte, mapped bool) {}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// Shamir's secret sharing over GF(2^8) with the AES polynomial
+// x^8 + x^4 + x^3 + x + 1. Each byte of the secret is the constant term of a
+// random polynomial of degree threshold-1, a share holds the values of all
+// polynomials at the same x. A share is encoded as x (1 byte) followed by the
+// values, any threshold shares reconstruct the secret by Lagrange
+// interpolation at x = 0.
+
+var gfExp, gfLog [256]byte
+
+func init() {
+	// 3 is a generator of the multiplicative group
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = byte(i)
+		x ^= gfDouble(x)
+	}
+	gfExp[255] = gfExp[0]
+}
+
+func gfDouble(x byte) byte {
+	if x&0x80 != 0 {
+		return x<<1 ^ 0x1b
+	}
+	return x << 1
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+int(gfLog[b]))%255]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+255-int(gfLog[b]))%255]
+}
+
+// splitSecret splits secret into n shares, any threshold of which are
+// required to reconstruct it.
+func splitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 2 || threshold > n || n > 255 {
+		return nil, fmt.Errorf("cannot split into %d shares with a threshold of %d", n, threshold)
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+	for j, b := range secret {
+		coefficients[0] = b
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			// Horner's method
+			y := byte(0)
+			for k := threshold - 1; k >= 0; k-- {
+				y = gfMul(y, share[0]) ^ coefficients[k]
+			}
+			share[j+1] = y
+		}
+	}
+	for i := range coefficients {
+		coefficients[i] = 0
+	}
+	return shares, nil
+}
+
+// combineShares reconstructs the secret from shares created by splitSecret.
+// Too few shares yield a wrong secret rather than an error, the result must
+// therefore be verified by the caller.
+func combineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("at least 2 shares are required")
+	}
+	seen := map[byte]bool{}
+	for _, share := range shares {
+		if len(share) < 2 || len(share) != len(shares[0]) {
+			return nil, fmt.Errorf("shares are malformed")
+		}
+		if share[0] == 0 || seen[share[0]] {
+			return nil, fmt.Errorf("shares are malformed or given twice")
+		}
+		seen[share[0]] = true
+	}
+
+	secret := make([]byte, len(shares[0])-1)
+	for i, si := range shares {
+		// Lagrange basis polynomial of share i evaluated at 0
+		basis := byte(1)
+		for j, sj := range shares {
+			if i == j {
+				continue
+			}
+			basis = gfMul(basis, gfDiv(sj[0], sj[0]^si[0]))
+		}
+		for k := range secret {
+			secret[k] ^= gfMul(basis, si[k+1])
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// subsets returns all subsets of size k of shares.
+func subsets(shares [][]byte, k int) [][][]byte {
+	if k == 0 {
+		return [][][]byte{{}}
+	}
+	out := [][][]byte{}
+	for i := 0; i <= len(shares)-k; i++ {
+		for _, rest := range subsets(shares[i+1:], k-1) {
+			out = append(out, append([][]byte{shares[i]}, rest...))
+		}
+	}
+	return out
+}
+
+func testSecret(t *testing.T) []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestShamirRoundTrip(t *testing.T) {
+	for _, tc := range []struct{ n, threshold int }{{2, 2}, {3, 2}, {5, 3}, {5, 5}, {7, 4}, {255, 2}} {
+		secret := testSecret(t)
+		shares, err := splitSecret(secret, tc.n, tc.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shares) != tc.n {
+			t.Fatalf("%d-of-%d: got %d shares", tc.threshold, tc.n, len(shares))
+		}
+
+		sets := subsets(shares, tc.threshold)
+		if tc.n > 10 {
+			sets = [][][]byte{shares[:tc.threshold], shares[tc.n-tc.threshold:], shares}
+		}
+		for _, set := range sets {
+			got, err := combineShares(set)
+			if err != nil {
+				t.Fatalf("%d-of-%d: %s", tc.threshold, tc.n, err)
+			}
+			if !bytes.Equal(got, secret) {
+				t.Fatalf("%d-of-%d: shares %v do not reconstruct the secret", tc.threshold, tc.n, set)
+			}
+		}
+		if got, err := combineShares(shares); err != nil || !bytes.Equal(got, secret) {
+			t.Fatalf("%d-of-%d: all shares do not reconstruct the secret: %v", tc.threshold, tc.n, err)
+		}
+	}
+}
+
+func TestShamirTooFewShares(t *testing.T) {
+	for _, tc := range []struct{ n, threshold int }{{3, 3}, {5, 3}, {7, 4}} {
+		secret := testSecret(t)
+		shares, err := splitSecret(secret, tc.n, tc.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// too few shares yield a wrong secret, see combineShares
+		for _, set := range subsets(shares, tc.threshold-1) {
+			got, err := combineShares(set)
+			if err == nil && bytes.Equal(got, secret) {
+				t.Fatalf("%d-of-%d: %d shares reconstruct the secret", tc.threshold, tc.n, len(set))
+			}
+		}
+	}
+
+	shares, err := splitSecret(testSecret(t), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := combineShares(shares[:1]); err == nil {
+		t.Fatal("single share accepted")
+	}
+}
+
+func TestShamirRejectsInvalidShares(t *testing.T) {
+	secret := testSecret(t)
+	shares, err := splitSecret(secret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clone := func(share []byte) []byte {
+		return append([]byte{}, share...)
+	}
+	zeroX := clone(shares[1])
+	zeroX[0] = 0
+	for name, set := range map[string][][]byte{
+		"duplicate":    {shares[0], shares[0]},
+		"same x":       {shares[0], append([]byte{shares[0][0]}, shares[1][1:]...)},
+		"zero x":       {shares[0], zeroX},
+		"truncated":    {shares[0], shares[1][:len(shares[1])-1]},
+		"empty":        {shares[0], {}},
+		"x only":       {shares[0][:1], shares[1][:1]},
+		"other length": {shares[0], append(clone(shares[1]), 0)},
+	} {
+		if _, err := combineShares(set); err == nil {
+			t.Errorf("%s: shares accepted", name)
+		}
+	}
+
+	// corrupted values cannot be detected by combineShares, the recovery
+	// key reassembled from them does not match its fingerprint though
+	key, err := newRecoveryIdentity(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := clone(shares[1])
+	corrupted[5] ^= 0x01
+	got, err := combineShares([][]byte{shares[0], corrupted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got, secret) {
+		t.Fatal("corrupted share reconstructs the secret")
+	}
+	other, err := newRecoveryIdentity(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Fingerprint() == key.Fingerprint() {
+		t.Fatal("corrupted share reassembles the recovery key")
+	}
+}
+
+func TestShamirRejectsInvalidParameters(t *testing.T) {
+	for _, tc := range []struct{ n, threshold int }{{3, 1}, {2, 3}, {256, 2}, {0, 0}} {
+		if _, err := splitSecret(testSecret(t), tc.n, tc.threshold); err == nil {
+			t.Errorf("%d-of-%d accepted", tc.threshold, tc.n)
+		}
+	}
+}
+
+func TestGFArithmetic(t *testing.T) {
+	// FIPS-197, section 4.2
+	if got := gfMul(0x57, 0x83); got != 0xc1 {
+		t.Fatalf("0x57 * 0x83 = %#x, expected 0xc1", got)
+	}
+	if got := gfMul(0x57, 0x13); got != 0xfe {
+		t.Fatalf("0x57 * 0x13 = %#x, expected 0xfe", got)
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if gfDiv(gfMul(byte(a), byte(b)), byte(b)) != byte(a) {
+				t.Fatalf("%#x * %#x / %#x != %#x", a, b, b, a)
+			}
+		}
+	}
+}
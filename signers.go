@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// signersFile lists the public keys (in the authorized_keys format) trusted
+// to write entries of a bag. It lives in the root of the bag and is only
+// trusted if signersSignatureFile holds a signature of it made by one of the
+// keys pinned in the option 'trusted_signers' of the configuration, anybody
+// able to write to the bag could change it otherwise.
+const (
+	signersFile          = ".signers"
+	signersSignatureFile = ".signers.sig"
+)
+
+// The policy for entries which are unsigned or not signed by a trusted
+// signer, see the option 'signatures' of the configuration.
+const (
+	signaturesWarn   = "warn"
+	signaturesRefuse = "refuse"
+)
+
+// bagSigner is a key listed in the signers file of a bag.
+type bagSigner struct {
+	Key     ssh.PublicKey
+	Comment string
+	Line    string
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key.
+func (s bagSigner) Fingerprint() string {
+	return ssh.FingerprintSHA256(s.Key)
+}
+
+// parseSigners reads public keys in the authorized_keys format, empty lines
+// and lines starting with '#' are ignored.
+func parseSigners(data []byte) ([]bagSigner, error) {
+	out := []bagSigner{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return out, fmt.Errorf("line %d: %s", n, err.Error())
+		}
+		out = append(out, bagSigner{Key: key, Comment: comment, Line: line})
+	}
+	return out, scanner.Err()
+}
+
+// signersMessage is what the signature of the signers file covers, it cannot
+// be mistaken for an entry.
+func signersMessage(data []byte) []byte {
+	return append([]byte("scum signers\x00"), data...)
+}
+
+// verifySigners checks that the signers file data is signed by one of the
+// pinned keys and returns the signers it lists.
+func verifySigners(data, sig []byte, pinned []string) ([]bagSigner, error) {
+	key, err := verifySSHSIG(sig, signersMessage(data))
+	if err != nil {
+		return nil, fmt.Errorf("signature of signers file is invalid: %s", err.Error())
+	}
+	fp := ssh.FingerprintSHA256(key)
+	for _, p := range pinned {
+		if p == fp {
+			return parseSigners(data)
+		}
+	}
+	return nil, fmt.Errorf("signers file is signed by %s which is not listed in trusted_signers", fp)
+}
+
+// formatSigners is the inverse of parseSigners.
+func formatSigners(ss []bagSigner) []byte {
+	var out bytes.Buffer
+	for _, s := range ss {
+		out.WriteString(s.Line)
+		out.WriteString("\n")
+	}
+	return out.Bytes()
+}
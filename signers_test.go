@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestVerifySigners(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := ssh.FingerprintSHA256(signer.PublicKey())
+
+	data := ssh.MarshalAuthorizedKey(signer.PublicKey())
+	sig, err := signSSHSIG(signer, signersMessage(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err := verifySigners(data, sig, []string{fp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 || ss[0].Fingerprint() != fp {
+		t.Fatalf("unexpected signers %v", ss)
+	}
+
+	if _, err := verifySigners(data, sig, []string{"SHA256:other"}); err == nil {
+		t.Error("signers file signed by a key which is not pinned accepted")
+	}
+	if _, err := verifySigners(append(data, []byte("# planted\n")...), sig, []string{fp}); err == nil {
+		t.Error("tampered signers file accepted")
+	}
+	if _, err := verifySigners(data, nil, []string{fp}); err == nil {
+		t.Error("unsigned signers file accepted")
+	}
+	if _, err := verifySigners(data, sig, nil); err == nil {
+		t.Error("signers file accepted without pinned keys")
+	}
+}
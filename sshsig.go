@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Signatures use the SSHSIG format of OpenSSH (see PROTOCOL.sshsig), the
+// signature over a file can thus be checked with
+//
+//	ssh-keygen -Y verify -n scum -s <signature> -f <allowed signers> -I <id>
+//
+// given the signed part of the file.
+const (
+	sshsigMagic     = "SSHSIG"
+	sshsigVersion   = 1
+	sshsigNamespace = "scum"
+	sshsigHash      = "sha512"
+)
+
+type sshsigBlob struct {
+	Version   uint32
+	PublicKey []byte
+	Namespace string
+	Reserved  string
+	HashAlg   string
+	Signature []byte
+}
+
+type sshsigSignedData struct {
+	Namespace string
+	Reserved  string
+	HashAlg   string
+	Hash      []byte
+}
+
+// hashSigner is implemented by signers which only sign SSHSIG blobs of scum
+// given the hash of the message, like the scum agent.
+type hashSigner interface {
+	SignSSHSIG(hash []byte) ([]byte, error)
+}
+
+// signSSHSIG signs message with signer and returns the binary SSHSIG blob.
+func signSSHSIG(signer ssh.Signer, message []byte) ([]byte, error) {
+	hash := sha512.Sum512(message)
+	if hs, ok := signer.(hashSigner); ok {
+		return hs.SignSSHSIG(hash[:])
+	}
+	return signSSHSIGHash(signer, hash[:])
+}
+
+// signSSHSIGHash signs the SHA-512 hash of a message with signer and returns
+// the binary SSHSIG blob, the namespace is always the one of scum.
+func signSSHSIGHash(signer ssh.Signer, hash []byte) ([]byte, error) {
+	if len(hash) != sha512.Size {
+		return []byte{}, fmt.Errorf("could not sign: hash must be %d bytes", sha512.Size)
+	}
+	data := sshsigHashData(hash)
+
+	var sig *ssh.Signature
+	var err error
+	if as, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// SHA-1 signatures are not accepted by OpenSSH
+		sig, err = as.SignWithAlgorithm(rand.Reader, data, ssh.SigAlgoRSASHA2512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return []byte{}, fmt.Errorf("could not sign: %s", err.Error())
+	}
+
+	blob := ssh.Marshal(sshsigBlob{
+		Version:   sshsigVersion,
+		PublicKey: signer.PublicKey().Marshal(),
+		Namespace: sshsigNamespace,
+		HashAlg:   sshsigHash,
+		Signature: ssh.Marshal(sig),
+	})
+	return append([]byte(sshsigMagic), blob...), nil
+}
+
+// verifySSHSIG checks the SSHSIG blob sig over message and returns the key
+// which made the signature. Whether that key is trusted is up to the caller.
+func verifySSHSIG(sig, message []byte) (ssh.PublicKey, error) {
+	if !bytes.HasPrefix(sig, []byte(sshsigMagic)) {
+		return nil, fmt.Errorf("signature is malformed")
+	}
+	blob := sshsigBlob{}
+	if err := ssh.Unmarshal(sig[len(sshsigMagic):], &blob); err != nil {
+		return nil, fmt.Errorf("signature is malformed: %s", err.Error())
+	}
+	if blob.Version != sshsigVersion || blob.Namespace != sshsigNamespace || blob.HashAlg != sshsigHash {
+		return nil, fmt.Errorf("signature version, namespace or hash algorithm is not supported")
+	}
+
+	pub, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("signature holds invalid public key: %s", err.Error())
+	}
+	s := ssh.Signature{}
+	if err := ssh.Unmarshal(blob.Signature, &s); err != nil {
+		return nil, fmt.Errorf("signature is malformed: %s", err.Error())
+	}
+	if s.Format == ssh.SigAlgoRSA {
+		return nil, fmt.Errorf("signature uses SHA-1 which is not accepted")
+	}
+
+	if err := pub.Verify(sshsigData(message), &s); err != nil {
+		return pub, fmt.Errorf("signature is invalid: %s", err.Error())
+	}
+	return pub, nil
+}
+
+// sshsigData returns the data which is actually signed for message.
+func sshsigData(message []byte) []byte {
+	hash := sha512.Sum512(message)
+	return sshsigHashData(hash[:])
+}
+
+// sshsigHashData returns the data which is actually signed for a message
+// with the given SHA-512 hash.
+func sshsigHashData(hash []byte) []byte {
+	data := ssh.Marshal(sshsigSignedData{
+		Namespace: sshsigNamespace,
+		HashAlg:   sshsigHash,
+		Hash:      hash,
+	})
+	return append([]byte(sshsigMagic), data...)
+}
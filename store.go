@@ -3,58 +3,165 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
-	"regexp"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	bagNameSeparator = "_"
+
+	transactionDir       = ".transaction"
+	transactionCommitted = ".committed"
+	transactionRemove    = ".remove-"
 )
 
-const bagNameSeparator = "_"
+// The backends a bag can be stored in, see the option 'store' of the
+// configuration and store_*.go.
+const (
+	storeDir   = "dir"
+	storeVault = "vault"
+	storeS3    = "s3"
+)
+
+// Store holds the files of a bag. Names are relative to the root of the bag
+// and use '/' as separator, sub directories hold the entries of folders and
+// information about the bag such as staged transactions.
+type Store interface {
+	// List returns the names of the files in the directory dir, "" is the
+	// root of the bag.
+	List(dir string) ([]string, error)
+	// Dirs returns the names of the sub directories of dir.
+	Dirs(dir string) ([]string, error)
+	// Read returns the content of a file, the error satisfies os.IsNotExist
+	// if there is no such file.
+	Read(name string) ([]byte, error)
+	// Write creates or replaces a file, readers either see the old or the
+	// new content.
+	Write(name string, data []byte) error
+	// Delete removes a file, it is not an error if there is no such file.
+	Delete(name string) error
+	// Stat returns information about a file, the error satisfies
+	// os.IsNotExist if there is no such file.
+	Stat(name string) (StoreInfo, error)
+	// String describes where the files are stored.
+	String() string
+}
+
+// batchStore is implemented by stores for which every change is expensive,
+// such as the vault. Transactions hold the changes and apply them at once.
+type batchStore interface {
+	// Hold keeps all following changes until Flush applies them, calls may
+	// be nested.
+	Hold()
+	// Flush applies the changes held once it matches the outermost Hold,
+	// they are discarded on error.
+	Flush() error
+}
+
+type StoreInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// checkStoreName rejects names of files which would leave the bag, e.g. read
+// from a transaction or a manifest pushed by somebody else.
+func checkStoreName(name string) error {
+	if name == "" || path.IsAbs(name) || filepath.IsAbs(name) || strings.Contains(name, "\\") {
+		return fmt.Errorf("invalid file name '%s'", name)
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return fmt.Errorf("invalid file name '%s'", name)
+		}
+	}
+	return nil
+}
+
+// notExist returns an error for the missing file name which satisfies
+// os.IsNotExist.
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
 
 type Bag struct {
+	// Base describes where the bag is stored
 	Base string
+
+	store Store
+
+	// manifest is set once the manifest of a bag hiding the names of its
+	// entries is opened, see manifest.go
+	manifest *manifest
+
+	// history is the number of previous revisions kept per entry, see
+	// history.go
+	history int
 }
 
-func NewBag(path string) (Bag, error) {
-	b := Bag{}
-	stat, err := os.Stat(path)
-	if err != nil {
-		return b, fmt.Errorf("scum bag '%s' could not be openend: %s", path, err.Error())
-	}
+func NewBag(s Store) (Bag, error) {
+	b := Bag{Base: s.String(), store: s}
 
-	if !stat.IsDir() {
-		return b, fmt.Errorf("scum bag '%s' is not a Directory", path)
+	err := b.recover()
+	if err != nil {
+		return b, err
 	}
 
-	b.Base = path
 	return b, nil
 }
 
+// List returns the types of the entries matching any of the filters by name,
+// see matchFilter. Entries in folders are listed as well.
 func (b Bag) List(filters []string) (map[string]string, error) {
 	if len(filters) == 0 {
 		filters = append(filters, ".*")
 	}
 	out := map[string]string{}
 
-	files, err := ioutil.ReadDir(b.Base)
+	if b.Hidden() {
+		if b.manifest == nil {
+			return out, b.errManifestClosed()
+		}
+		for _, e := range b.manifest.Entries {
+			for _, filter := range filters {
+				if matchFilter(filter, e.Name) {
+					out[e.Name] = e.Kind
+				}
+			}
+		}
+		return out, nil
+	}
+
+	// hidden files and directories hold information about the bag itself
+	files, err := storeFiles(b.store, "", func(dir string) bool {
+		return strings.HasPrefix(path.Base(dir), ".")
+	})
 	if err != nil {
 		return out, fmt.Errorf("scum bag '%s' could not be listed: %s", b.Base, err.Error())
 	}
 
 	for _, file := range files {
-		if file.IsDir() {
+		dir, base := path.Split(file)
+		if strings.HasPrefix(base, ".") {
 			continue
 		}
 
-		seg := strings.SplitN(file.Name(), bagNameSeparator, 2)
-		if len(seg) < 2 {
-			return out, fmt.Errorf("scum bag '%s' contains malformed file: %s", b.Base, file.Name())
+		// other files, e.g. a README, may be kept next to the entries
+		seg := strings.SplitN(base, bagNameSeparator, 2)
+		if _, known := ptr[seg[0]]; len(seg) < 2 || !known {
+			fmt.Fprintf(os.Stderr, "warning: scum bag '%s' contains file '%s' which is not an entry, skipping it\n", b.Base, file)
+			continue
 		}
 
 		kind := seg[0]
-		name := seg[1]
+		name := dir + seg[1]
 		for _, filter := range filters {
-			if matched, _ := regexp.MatchString(filter, name); matched {
+			if matchFilter(filter, name) {
 				out[name] = kind
 			}
 		}
@@ -63,12 +170,607 @@ func (b Bag) List(filters []string) (map[string]string, error) {
 	return out, nil
 }
 
+// storeFiles returns the names of all files below dir, sub directories for
+// which skip returns true are left out.
+func storeFiles(s Store, dir string, skip func(dir string) bool) ([]string, error) {
+	files, err := s.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := s.Dirs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		if skip(d) {
+			continue
+		}
+		sub, err := storeFiles(s, d, skip)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, sub...)
+	}
+	return files, nil
+}
+
 func (b Bag) Read(name, kind string) ([]byte, error) {
-	path := path.Join(b.Base, fmt.Sprintf("%s%s%s", kind, bagNameSeparator, name))
-	return ioutil.ReadFile(path)
+	file, err := b.entryFile(name, kind, false)
+	if err != nil {
+		return nil, err
+	}
+	return b.store.Read(file)
 }
 
+// KeepHistory sets the number of previous revisions kept per entry, none are
+// kept by default.
+func (b *Bag) KeepHistory(n int) {
+	b.history = n
+}
+
+// Write stores an entry, the replaced content is kept in the history of the
+// entry. A bag hiding the names of its entries only lists a new entry once the
+// manifest is written with WriteManifest.
 func (b Bag) Write(name, kind string, data []byte) error {
-	path := path.Join(b.Base, fmt.Sprintf("%s%s%s", kind, bagNameSeparator, name))
-	return ioutil.WriteFile(path, data, 0600)
+	file, err := b.entryFile(name, kind, true)
+	if err != nil {
+		return err
+	}
+	return b.batch(func() error {
+		if err := b.archive(file); err != nil {
+			return err
+		}
+		return b.store.Write(file, data)
+	})
+}
+
+// batch runs fn with the changes to the store held until it is done, if the
+// store supports it.
+func (b Bag) batch(fn func() error) error {
+	bs, ok := b.store.(batchStore)
+	if !ok {
+		return fn()
+	}
+	bs.Hold()
+	err := fn()
+	if ferr := bs.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// Stat returns information about the file of an entry.
+func (b Bag) Stat(name, kind string) (StoreInfo, error) {
+	file, err := b.entryFile(name, kind, false)
+	if err != nil {
+		return StoreInfo{}, err
+	}
+	return b.store.Stat(file)
+}
+
+// ReadMeta returns the metadata file of an entry, see metadata.go. The error
+// satisfies os.IsNotExist if the entry has no metadata.
+func (b Bag) ReadMeta(name, kind string) ([]byte, error) {
+	file, err := b.entryFile(name, kind, false)
+	if err != nil {
+		return nil, err
+	}
+	return b.store.Read(path.Join(metaDir, file))
+}
+
+// WriteMeta replaces the metadata file of an entry, the entry must exist.
+func (b Bag) WriteMeta(name, kind string, data []byte) error {
+	file, err := b.entryFile(name, kind, false)
+	if err != nil {
+		return err
+	}
+	return b.store.Write(path.Join(metaDir, file), data)
+}
+
+// entryFile returns the name of the file of an entry, an ID is assigned to a
+// new entry of a bag hiding the names if add is set.
+func (b Bag) entryFile(name, kind string, add bool) (string, error) {
+	if b.manifest == nil {
+		if b.Hidden() {
+			return "", b.errManifestClosed()
+		}
+		return entryFileName(name, kind), nil
+	}
+	if add {
+		return b.manifest.add(name, kind)
+	}
+	id, ok := b.manifest.lookup(name, kind)
+	if !ok {
+		return "", fmt.Errorf("scum bag '%s' has no entry '%s' of type %s", b.Base, name, kind)
+	}
+	return id, nil
+}
+
+// Hidden reports whether the bag stores its entries under random IDs and
+// lists their names in an encrypted manifest.
+func (b Bag) Hidden() bool {
+	_, err := b.store.Stat(manifestFile)
+	return err == nil
+}
+
+// OpenManifest decrypts the manifest of a bag hiding the names of its
+// entries, which is required to access them.
+func (b *Bag) OpenManifest(c Crypt, pass []byte) error {
+	data, err := b.store.Read(manifestFile)
+	if err != nil {
+		return fmt.Errorf("manifest of scum bag '%s' could not be read: %s", b.Base, err.Error())
+	}
+	m, err := decryptManifest(c, data, pass)
+	if err != nil {
+		return fmt.Errorf("manifest of scum bag '%s' could not be decrypted: %s", b.Base, err.Error())
+	}
+	b.manifest = m
+	return nil
+}
+
+// WriteManifest encrypts the manifest with c and replaces the manifest file,
+// it does nothing for a bag which does not hide the names of its entries.
+func (b Bag) WriteManifest(c Crypt) error {
+	if b.manifest == nil {
+		return nil
+	}
+	data, err := encryptManifest(c, b.manifest)
+	if err != nil {
+		return err
+	}
+	return b.store.Write(manifestFile, data)
+}
+
+// ManifestIsCurrent reports whether the manifest is encrypted for the current
+// recipients of c, it is for a bag which does not hide the names.
+func (b Bag) ManifestIsCurrent(c Crypt) (bool, error) {
+	if !b.Hidden() {
+		return true, nil
+	}
+	data, err := b.store.Read(manifestFile)
+	if err != nil {
+		return false, fmt.Errorf("manifest of scum bag '%s' could not be read: %s", b.Base, err.Error())
+	}
+	return c.IsCurrent(data), nil
+}
+
+// Hide moves all entries to files named by random IDs and lists their names
+// in a manifest encrypted with c. The entries themselves are not re-encrypted,
+// their associated data still binds them to their names.
+func (b *Bag) Hide(c Crypt) (int, error) {
+	list, err := b.List([]string{})
+	if err != nil {
+		return 0, err
+	}
+
+	hidden := *b
+	hidden.manifest = newManifest()
+	t, err := hidden.Begin()
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range sortedNames(list) {
+		kind := list[name]
+		err = func() error {
+			data, err := b.Read(name, kind)
+			if err != nil {
+				return err
+			}
+			if err := t.Write(name, kind, data); err != nil {
+				return err
+			}
+			if err := t.Remove(entryFileName(name, kind)); err != nil {
+				return err
+			}
+
+			// the history would reveal the names as well
+			revs, err := b.History(name, kind)
+			if err != nil {
+				return err
+			}
+			for _, r := range revs {
+				data, err := b.ReadRevision(r)
+				if err != nil {
+					return err
+				}
+				if err := t.WriteRevision(name, kind, r, data); err != nil {
+					return err
+				}
+				if err := t.Remove(r.file); err != nil {
+					return err
+				}
+			}
+
+			meta, err := b.ReadMeta(name, kind)
+			if os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := t.WriteMeta(name, kind, meta); err != nil {
+				return err
+			}
+			return t.Remove(path.Join(metaDir, entryFileName(name, kind)))
+		}()
+		if err != nil {
+			t.Rollback()
+			return 0, fmt.Errorf("entry '%s' could not be moved: %s", name, err.Error())
+		}
+	}
+	if err := t.WriteManifest(c); err != nil {
+		t.Rollback()
+		return 0, err
+	}
+	if err := t.Commit(); err != nil {
+		return 0, err
+	}
+
+	*b = hidden
+	return len(list), nil
+}
+
+func (b Bag) errManifestClosed() error {
+	return fmt.Errorf("scum bag '%s' hides the names of its entries, its manifest has to be opened first", b.Base)
+}
+
+// Recipients returns the recipients listed in the recipients file of the bag.
+// A bag without such a file has no additional recipients.
+func (b Bag) Recipients() ([]bagRecipient, error) {
+	data, err := b.store.Read(recipientsFile)
+	if os.IsNotExist(err) {
+		return []bagRecipient{}, nil
+	} else if err != nil {
+		return []bagRecipient{}, fmt.Errorf("recipients of scum bag '%s' could not be read: %s", b.Base, err.Error())
+	}
+
+	rs, err := parseRecipients(data)
+	if err != nil {
+		return rs, fmt.Errorf("recipients file '%s' is malformed: %s", recipientsFile, err.Error())
+	}
+	return rs, nil
+}
+
+// WriteRecipients replaces the recipients file of the bag.
+func (b Bag) WriteRecipients(rs []bagRecipient) error {
+	return b.store.Write(recipientsFile, formatRecipients(rs))
+}
+
+// Signers returns the trusted signers listed in the signers file of the bag.
+// The result is nil for a bag without such a file.
+func (b Bag) Signers() ([]bagSigner, error) {
+	data, err := b.store.Read(signersFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("signers of scum bag '%s' could not be read: %s", b.Base, err.Error())
+	}
+
+	ss, err := parseSigners(data)
+	if err != nil {
+		return ss, fmt.Errorf("signers file '%s' is malformed: %s", signersFile, err.Error())
+	}
+	return ss, nil
+}
+
+// TrustedSigners returns the fingerprints of the keys trusted to sign
+// entries: the pinned ones and the signers of the bag if the signers file is
+// signed by one of the pinned keys. The error tells why the signers file is
+// not trusted, the pinned keys are returned regardless.
+func (b Bag) TrustedSigners(pinned []string) ([]string, error) {
+	trusted := append([]string{}, pinned...)
+	data, err := b.store.Read(signersFile)
+	if os.IsNotExist(err) {
+		return trusted, fmt.Errorf("scum bag '%s' has no signers file", b.Base)
+	} else if err != nil {
+		return trusted, fmt.Errorf("signers of scum bag '%s' could not be read: %s", b.Base, err.Error())
+	}
+	sig, err := b.store.Read(signersSignatureFile)
+	if os.IsNotExist(err) {
+		return trusted, fmt.Errorf("signers file of scum bag '%s' is not signed", b.Base)
+	} else if err != nil {
+		return trusted, fmt.Errorf("signature of the signers of scum bag '%s' could not be read: %s", b.Base, err.Error())
+	}
+
+	ss, err := verifySigners(data, sig, pinned)
+	if err != nil {
+		return trusted, err
+	}
+	for _, s := range ss {
+		trusted = append(trusted, s.Fingerprint())
+	}
+	return trusted, nil
+}
+
+// WriteSigners replaces the signers file of the bag along with its signature
+// made with c.
+func (b Bag) WriteSigners(ss []bagSigner, c Crypt) error {
+	t, err := b.Begin()
+	if err != nil {
+		return err
+	}
+	if err := t.WriteSigners(ss, c); err != nil {
+		t.Rollback()
+		return err
+	}
+	return t.Commit()
+}
+
+// Transaction collects changes to a bag in a staging directory and applies
+// all of them with Commit. If applying the changes gets interrupted, NewBag
+// finishes the job the next time the bag is opened. A transaction which has
+// not been committed is discarded.
+type Transaction struct {
+	bag Bag
+}
+
+// Begin starts a new transaction, there can only be one at a time. Stores
+// for which every change is expensive apply all changes of the transaction
+// on Commit or Rollback at once.
+func (b Bag) Begin() (Transaction, error) {
+	t := Transaction{bag: b}
+
+	if bs, ok := b.store.(batchStore); ok {
+		bs.Hold()
+	}
+	if err := t.discard(); err != nil {
+		t.flush()
+		return t, fmt.Errorf("stale transaction of scum bag '%s' could not be removed: %s", b.Base, err.Error())
+	}
+	return t, nil
+}
+
+// stage writes a file to the staging directory, the name is escaped so that
+// files of sub directories are staged next to all others.
+func (t Transaction) stage(file string, data []byte) error {
+	return t.bag.store.Write(path.Join(transactionDir, url.PathEscape(file)), data)
+}
+
+// Write stages an entry to be written on commit. A bag hiding the names of
+// its entries only lists a new entry if the manifest is staged as well.
+func (t Transaction) Write(name, kind string, data []byte) error {
+	file, err := t.bag.entryFile(name, kind, true)
+	if err != nil {
+		return err
+	}
+	return t.stage(file, data)
+}
+
+// WriteMeta stages the metadata of an entry to be written on commit.
+func (t Transaction) WriteMeta(name, kind string, data []byte) error {
+	file, err := t.bag.entryFile(name, kind, true)
+	if err != nil {
+		return err
+	}
+	return t.stage(path.Join(metaDir, file), data)
+}
+
+// Remove stages a file of the bag to be removed on commit.
+func (t Transaction) Remove(file string) error {
+	return t.stage(transactionRemove+file, []byte{})
+}
+
+// WriteManifest stages the manifest, encrypted with c, to be replaced on
+// commit. It does nothing for a bag which does not hide the names.
+func (t Transaction) WriteManifest(c Crypt) error {
+	if t.bag.manifest == nil {
+		return nil
+	}
+	data, err := encryptManifest(c, t.bag.manifest)
+	if err != nil {
+		return err
+	}
+	return t.stage(manifestFile, data)
+}
+
+// WriteRecipients stages the recipients file to be replaced on commit.
+func (t Transaction) WriteRecipients(rs []bagRecipient) error {
+	return t.stage(recipientsFile, formatRecipients(rs))
+}
+
+// WriteSigners stages the signers file and its signature made with c to be
+// replaced on commit.
+func (t Transaction) WriteSigners(ss []bagSigner, c Crypt) error {
+	data := formatSigners(ss)
+	sig, err := c.Sign(signersMessage(data))
+	if err != nil {
+		return fmt.Errorf("signers file could not be signed: %s", err.Error())
+	}
+	if err := t.stage(signersFile, data); err != nil {
+		return err
+	}
+	return t.stage(signersSignatureFile, sig)
+}
+
+// WriteACL stages the acl file to be replaced on commit.
+func (t Transaction) WriteACL(acl ACL) error {
+	data, err := yaml.Marshal(acl)
+	if err != nil {
+		return err
+	}
+	return t.stage(aclFile, data)
+}
+
+// WriteRecovery stages the recovery file to be replaced on commit.
+func (t Transaction) WriteRecovery(rc recoveryConfig) error {
+	data, err := yaml.Marshal(rc)
+	if err != nil {
+		return err
+	}
+	return t.stage(recoveryFile, data)
+}
+
+// Commit applies all staged changes.
+func (t Transaction) Commit() error {
+	err := t.stage(transactionCommitted, []byte{})
+	if err == nil {
+		err = t.bag.recover()
+	}
+	if ferr := t.flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return fmt.Errorf("transaction of scum bag '%s' could not be committed: %s", t.bag.Base, err.Error())
+	}
+	return nil
+}
+
+// Rollback discards all staged changes.
+func (t Transaction) Rollback() error {
+	err := t.discard()
+	if ferr := t.flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// discard removes all staged files.
+func (t Transaction) discard() error {
+	files, err := t.bag.store.List(transactionDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := t.bag.store.Delete(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush applies the changes held by the store since Begin.
+func (t Transaction) flush() error {
+	if bs, ok := t.bag.store.(batchStore); ok {
+		return bs.Flush()
+	}
+	return nil
+}
+
+// recover applies a committed transaction. Every staged file is deleted once
+// it has been applied and applying it again does no harm, a transaction can
+// therefore be applied several times. The mark of the commit goes last.
+func (b Bag) recover() error {
+	committed := path.Join(transactionDir, transactionCommitted)
+	if _, err := b.store.Stat(committed); err != nil {
+		return nil
+	}
+
+	files, err := b.store.List(transactionDir)
+	if err != nil {
+		return fmt.Errorf("transaction of scum bag '%s' could not be read: %s", b.Base, err.Error())
+	}
+	for _, file := range files {
+		if file == committed {
+			continue
+		}
+		err = b.apply(file)
+		if err != nil {
+			return fmt.Errorf("transaction of scum bag '%s' could not be applied: %s", b.Base, err.Error())
+		}
+	}
+
+	return b.store.Delete(committed)
+}
+
+// apply moves the staged file into place, or removes the file it marks for
+// removal.
+func (b Bag) apply(staged string) error {
+	target, err := url.PathUnescape(path.Base(staged))
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(target, transactionRemove) {
+		target = strings.TrimPrefix(target, transactionRemove)
+		if err := checkStoreName(target); err != nil {
+			return err
+		}
+		if err := b.store.Delete(target); err != nil {
+			return err
+		}
+		return b.store.Delete(staged)
+	}
+	if err := checkStoreName(target); err != nil {
+		return err
+	}
+
+	data, err := b.store.Read(staged)
+	if err != nil {
+		return err
+	}
+	if err := b.store.Write(target, data); err != nil {
+		return err
+	}
+	return b.store.Delete(staged)
+}
+
+// entryAssociatedData identifies an entry, it is bound to the encrypted data
+// of the entry so the file cannot be renamed or swapped with another one.
+func entryAssociatedData(name, kind string) []byte {
+	return []byte("scum entry\x00" + kind + "\x00" + name)
+}
+
+func entryFileName(name, kind string) string {
+	dir, base := path.Split(name)
+	return fmt.Sprintf("%s%s%s%s", dir, kind, bagNameSeparator, base)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// afterwards, readers therefore either see the old or the new content.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ACL returns the access control list of the bag. A bag without an acl file
+// grants every recipient access to all entries.
+func (b Bag) ACL() (ACL, error) {
+	acl := ACL{}
+	data, err := b.store.Read(aclFile)
+	if os.IsNotExist(err) {
+		return acl, nil
+	} else if err != nil {
+		return acl, fmt.Errorf("acl of scum bag '%s' could not be read: %s", b.Base, err.Error())
+	}
+
+	err = yaml.Unmarshal(data, &acl)
+	if err != nil {
+		return acl, fmt.Errorf("acl file '%s' is malformed: %s", aclFile, err.Error())
+	}
+	return acl, nil
+}
+
+// Recovery returns the shares of the recovery key of the bag. A bag without a
+// recovery file has no recovery key, the fingerprint is empty in that case.
+func (b Bag) Recovery() (recoveryConfig, error) {
+	rc := recoveryConfig{}
+	data, err := b.store.Read(recoveryFile)
+	if os.IsNotExist(err) {
+		return rc, nil
+	} else if err != nil {
+		return rc, fmt.Errorf("recovery file of scum bag '%s' could not be read: %s", b.Base, err.Error())
+	}
+
+	err = yaml.Unmarshal(data, &rc)
+	if err != nil {
+		return rc, fmt.Errorf("recovery file '%s' is malformed: %s", recoveryFile, err.Error())
+	}
+	return rc, nil
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// dirStore keeps the files of a bag in a directory, which is usually shared
+// by putting it under version control.
+type dirStore struct {
+	base string
+}
+
+func newDirStore(base string) (dirStore, error) {
+	s := dirStore{base: base}
+	stat, err := os.Stat(base)
+	if err != nil {
+		return s, fmt.Errorf("scum bag '%s' could not be openend: %s", base, err.Error())
+	}
+
+	if !stat.IsDir() {
+		return s, fmt.Errorf("scum bag '%s' is not a Directory", base)
+	}
+	return s, nil
+}
+
+// path returns the path of the file name, which must not leave the bag.
+func (s dirStore) path(name string) (string, error) {
+	if name != "" {
+		if err := checkStoreName(name); err != nil {
+			return "", err
+		}
+	}
+	p := filepath.Join(s.base, filepath.FromSlash(name))
+	rel, err := filepath.Rel(s.base, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file name '%s'", name)
+	}
+	return p, nil
+}
+
+func (s dirStore) List(dir string) ([]string, error) {
+	out := []string{}
+	p, err := s.path(dir)
+	if err != nil {
+		return out, err
+	}
+	files, err := ioutil.ReadDir(p)
+	if os.IsNotExist(err) && dir != "" {
+		return out, nil
+	} else if err != nil {
+		return out, err
+	}
+
+	for _, file := range files {
+		// leftovers of interrupted writes, see writeFileAtomic
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".tmp-") {
+			continue
+		}
+		out = append(out, path.Join(dir, file.Name()))
+	}
+	return out, nil
+}
+
+func (s dirStore) Dirs(dir string) ([]string, error) {
+	out := []string{}
+	p, err := s.path(dir)
+	if err != nil {
+		return out, err
+	}
+	files, err := ioutil.ReadDir(p)
+	if os.IsNotExist(err) && dir != "" {
+		return out, nil
+	} else if err != nil {
+		return out, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			out = append(out, path.Join(dir, file.Name()))
+		}
+	}
+	return out, nil
+}
+
+func (s dirStore) Read(name string) ([]byte, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(p)
+}
+
+func (s dirStore) Write(name string, data []byte) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(p, data, 0600)
+}
+
+// Delete removes the file as well as its directories once they are empty,
+// apart from the root of the bag.
+func (s dirStore) Delete(name string) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := filepath.Dir(p); dir != filepath.Clean(s.base); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s dirStore) Stat(name string) (StoreInfo, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return StoreInfo{}, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return StoreInfo{}, err
+	}
+	if info.IsDir() {
+		return StoreInfo{}, fmt.Errorf("%s is a directory", name)
+	}
+	return StoreInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s dirStore) String() string {
+	return s.base
+}
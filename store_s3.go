@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// s3Store keeps the files of a bag as objects below a prefix of an S3 bucket,
+// which allows a team to share a bag without version control. Any S3
+// compatible object store (e.g. MinIO) can be used by setting the endpoint.
+// Credentials are taken from the environment or the shared credentials file
+// as usual for the AWS SDK.
+type s3Store struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+// s3Timeout limits every request, a stalled endpoint would otherwise keep
+// scum waiting forever, e.g. in the middle of a transaction.
+const s3Timeout = 30 * time.Second
+
+func newS3Store(endpoint, region, bucket, prefix string) (*s3Store, error) {
+	cfg := aws.NewConfig().
+		WithRegion(region).
+		WithHTTPClient(&http.Client{Timeout: s3Timeout})
+	if endpoint != "" {
+		// object stores other than S3 rarely support virtual hosted buckets
+		cfg = cfg.WithEndpoint(endpoint).WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up S3 session: %s", err.Error())
+	}
+
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Store{client: s3.New(sess), bucket: bucket, prefix: prefix}, nil
+}
+
+// key returns the key of the object name, which must not leave the prefix.
+func (s *s3Store) key(name string) (string, error) {
+	if err := checkStoreName(name); err != nil {
+		return "", err
+	}
+	return s.prefix + name, nil
+}
+
+func (s *s3Store) List(dir string) ([]string, error) {
+	files, _, err := s.list(dir)
+	return files, err
+}
+
+func (s *s3Store) Dirs(dir string) ([]string, error) {
+	_, dirs, err := s.list(dir)
+	return dirs, err
+}
+
+// list returns the objects and the common prefixes, i.e. the sub directories,
+// below dir.
+func (s *s3Store) list(dir string) ([]string, []string, error) {
+	files, dirs := []string{}, []string{}
+	prefix := s.prefix
+	if dir != "" {
+		key, err := s.key(dir)
+		if err != nil {
+			return files, dirs, err
+		}
+		prefix = key + "/"
+	}
+
+	in := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}
+	err := s.client.ListObjectsV2Pages(in, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			files = append(files, path.Join(dir, strings.TrimPrefix(aws.StringValue(o.Key), prefix)))
+		}
+		for _, p := range page.CommonPrefixes {
+			dirs = append(dirs, path.Join(dir, strings.TrimPrefix(aws.StringValue(p.Prefix), prefix)))
+		}
+		return true
+	})
+	return files, dirs, s.err("list", dir, err)
+}
+
+func (s *s3Store) Read(name string) ([]byte, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s.err("read", name, err)
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (s *s3Store) Write(name string, data []byte) error {
+	key, err := s.key(name)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	return s.err("write", name, err)
+}
+
+func (s *s3Store) Delete(name string) error {
+	key, err := s.key(name)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err := s.err("delete", name, err); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *s3Store) Stat(name string) (StoreInfo, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return StoreInfo{}, err
+	}
+	resp, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return StoreInfo{}, s.err("stat", name, err)
+	}
+	return StoreInfo{Size: aws.Int64Value(resp.ContentLength), ModTime: aws.TimeValue(resp.LastModified)}, nil
+}
+
+func (s *s3Store) String() string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, s.prefix)
+}
+
+// err turns the error of a request for name into an error satisfying
+// os.IsNotExist if the object does not exist.
+func (s *s3Store) err(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return notExist(op, name)
+		}
+	}
+	return fmt.Errorf("could not %s '%s' in %s: %s", op, name, s.String(), err.Error())
+}
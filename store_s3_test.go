@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-memory S3 bucket answering the path style requests of
+// s3Store.
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+type fakeS3List struct {
+	XMLName        xml.Name `xml:"ListBucketResult"`
+	Name           string
+	Prefix         string
+	KeyCount       int
+	IsTruncated    bool
+	Contents       []fakeS3Object
+	CommonPrefixes []fakeS3Prefix
+}
+
+type fakeS3Object struct {
+	Key  string
+	Size int
+}
+
+type fakeS3Prefix struct {
+	Prefix string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if p != f.bucket && !strings.HasPrefix(p, f.bucket+"/") {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(p, f.bucket), "/")
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter"))
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			// HEAD responses have no body, the SDK reports NotFound
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	case r.Method == http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			f.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = data
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix, delimiter string) {
+	out := fakeS3List{Name: f.bucket, Prefix: prefix}
+	prefixes := map[string]bool{}
+	keys := []string{}
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(key, prefix)
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			p := prefix + rest[:i+len(delimiter)]
+			if !prefixes[p] {
+				prefixes[p] = true
+				out.CommonPrefixes = append(out.CommonPrefixes, fakeS3Prefix{p})
+			}
+			continue
+		}
+		out.Contents = append(out.Contents, fakeS3Object{Key: key, Size: len(f.objects[key])})
+	}
+	out.KeyCount = len(out.Contents) + len(out.CommonPrefixes)
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(out)
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func TestS3Store(t *testing.T) {
+	for name, value := range map[string]string{"AWS_ACCESS_KEY_ID": "test", "AWS_SECRET_ACCESS_KEY": "test"} {
+		old, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		if ok {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+
+	fake := &fakeS3{bucket: "bucket", objects: map[string][]byte{"other/aws_prod": []byte("other")}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s, err := newS3Store(server.URL, "us-east-1", "bucket", "/team/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string]string{"aws_prod": "1", "clients/acme/aws_prod": "2", ".meta/aws_prod": "3"} {
+		if err := s.Write(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, ok := fake.objects["team/clients/acme/aws_prod"]; !ok || string(data) != "2" {
+		t.Fatalf("object not written below the prefix: %v", fake.objects)
+	}
+
+	files, err := s.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{"aws_prod"}) {
+		t.Errorf("unexpected files %v", files)
+	}
+	dirs, err := s.Dirs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dirs, []string{".meta", "clients"}) {
+		t.Errorf("unexpected directories %v", dirs)
+	}
+	if dirs, err := s.Dirs("clients"); err != nil || !reflect.DeepEqual(dirs, []string{"clients/acme"}) {
+		t.Errorf("unexpected sub directories %v: %v", dirs, err)
+	}
+	if files, err := s.List("clients/acme"); err != nil || !reflect.DeepEqual(files, []string{"clients/acme/aws_prod"}) {
+		t.Errorf("unexpected files in sub directory %v: %v", files, err)
+	}
+
+	data, err := s.Read("clients/acme/aws_prod")
+	if err != nil || string(data) != "2" {
+		t.Fatalf("unexpected content %q: %v", data, err)
+	}
+	info, err := s.Stat("aws_prod")
+	if err != nil || info.Size != 1 {
+		t.Fatalf("unexpected info %v: %v", info, err)
+	}
+
+	if err := s.Delete("aws_prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("aws_prod"); err != nil {
+		t.Fatalf("deleting a missing object failed: %s", err)
+	}
+	if _, err := s.Read("aws_prod"); !os.IsNotExist(err) {
+		t.Errorf("reading a missing object: expected not exist, got %v", err)
+	}
+	if _, err := s.Stat("aws_prod"); !os.IsNotExist(err) {
+		t.Errorf("stat of a missing object: expected not exist, got %v", err)
+	}
+	if string(fake.objects["other/aws_prod"]) != "other" {
+		t.Error("object outside of the prefix changed")
+	}
+
+	if s.client.Config.HTTPClient.Timeout == 0 {
+		t.Error("requests to S3 do not time out")
+	}
+	before := len(fake.objects)
+	for _, name := range []string{"../other/aws_prod", "/aws_prod", "a//b", "clients/../../other/aws_prod"} {
+		if err := s.Write(name, []byte("pwned")); err == nil {
+			t.Errorf("%s: write accepted", name)
+		}
+		if _, err := s.Read(name); err == nil || os.IsNotExist(err) {
+			t.Errorf("%s: read accepted", name)
+		}
+		if err := s.Delete(name); err == nil {
+			t.Errorf("%s: delete accepted", name)
+		}
+		if _, err := s.Stat(name); err == nil || os.IsNotExist(err) {
+			t.Errorf("%s: stat accepted", name)
+		}
+		if _, err := s.List(name); err == nil {
+			t.Errorf("%s: list accepted", name)
+		}
+	}
+	if len(fake.objects) != before || string(fake.objects["other/aws_prod"]) != "other" {
+		t.Error("object outside of the prefix written")
+	}
+
+	missing, err := newS3Store(server.URL, "us-east-1", "missing", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := missing.Read("aws_prod"); err == nil || os.IsNotExist(err) {
+		t.Errorf("missing bucket: expected an error other than not exist, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckStoreName(t *testing.T) {
+	for _, name := range []string{"aws_prod", ".meta/aws_prod", ".transaction/.committed", "clients/acme/aws_prod"} {
+		if err := checkStoreName(name); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+	for _, name := range []string{"", "/etc/passwd", "../pwned", "a/../../pwned", "a//b", "./a", "a\\..\\b"} {
+		if err := checkStoreName(name); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestRecoverRejectsEscapingTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "bag")
+	staged := filepath.Join(base, transactionDir)
+	if err := os.MkdirAll(staged, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(staged, "..%2Fpwned"), []byte("pwned"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(staged, transactionCommitted), []byte{}, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newDirStore(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBag(s); err == nil {
+		t.Fatal("transaction escaping the bag was applied")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); !os.IsNotExist(err) {
+		t.Fatalf("file outside of the bag was written: %v", err)
+	}
+}
+
+func TestDirStoreRejectsEscapingNames(t *testing.T) {
+	s := dirStore{base: "/tmp/bag"}
+	if _, err := s.path("../pwned"); err == nil {
+		t.Fatal("path outside of the bag accepted")
+	}
+	if p, err := s.path("clients/aws_prod"); err != nil || p != filepath.Join("/tmp/bag", "clients", "aws_prod") {
+		t.Fatalf("unexpected path %s: %v", p, err)
+	}
+}
+
+func TestDecryptManifestRejectsInvalidIDs(t *testing.T) {
+	if !manifestIDRegexp.MatchString("0123456789abcdef0123456789abcdef") {
+		t.Fatal("valid ID rejected")
+	}
+	for _, id := range []string{"../aws_prod", "", "0123456789ABCDEF0123456789ABCDEF", "0123456789abcdef0123456789abcdef/x"} {
+		if manifestIDRegexp.MatchString(id) {
+			t.Errorf("%s: accepted", id)
+		}
+	}
+}
+
+func TestBagListSkipsUnknownFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, file := range []string{"aws_prod", "README", "clients/acme/aws_prod", "clients/README", "clients/notes_2024.txt", "clients/acme/.gitkeep"} {
+		p := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte{}, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := newDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBag(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := b.List([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list["prod"] != "aws" || list["clients/acme/prod"] != "aws" {
+		t.Fatalf("unexpected entries %v", list)
+	}
+}
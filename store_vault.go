@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// vaultStore keeps all files of a bag in a single file, the vault. The vault
+// is encrypted as a whole for the recipients listed in the recipients file it
+// contains, so the names of the entries and the recipients are only visible
+// to the recipients. A vault which does not exist yet is created with the
+// first file written.
+//
+// Every change rewrites the whole vault, unless changes are held for a
+// transaction (see batchStore). The vault is locked while it is written, a
+// vault changed by another process since it was read is not overwritten.
+type vaultStore struct {
+	path  string
+	crypt Crypt
+
+	mu    sync.Mutex
+	files map[string]vaultFile
+	// loaded is the vault file as read or last written, nil if it did not
+	// exist
+	loaded []byte
+	// held holds the files as of the last save while changes are held,
+	// holds counts the calls of Hold not yet matched by Flush
+	held  map[string]vaultFile
+	holds int
+}
+
+type vaultFile struct {
+	Data    []byte    `json:"data"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// vaultAssociatedData is bound to the encrypted vault so it cannot be swapped
+// with an entry.
+func vaultAssociatedData() []byte {
+	return []byte("scum vault")
+}
+
+// openVaultStore decrypts the vault at file with c, pass is only called if
+// the vault exists.
+func openVaultStore(file string, c Crypt, pass func() (*SecretBuffer, error)) (*vaultStore, error) {
+	s := &vaultStore{path: file, crypt: c, files: map[string]vaultFile{}}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return s, fmt.Errorf("vault '%s' could not be read: %s", file, err.Error())
+	}
+	s.loaded = data
+
+	pw, err := pass()
+	if err != nil {
+		return s, err
+	}
+	plain, err := c.Decrypt(data, vaultAssociatedData(), pw.Bytes())
+	if err != nil {
+		return s, fmt.Errorf("vault '%s' could not be decrypted: %s", file, err.Error())
+	}
+	defer plain.Destroy()
+
+	if err := json.Unmarshal(plain.Bytes(), &s.files); err != nil {
+		return s, fmt.Errorf("vault '%s' is malformed: %s", file, err.Error())
+	}
+	return s, nil
+}
+
+func (s *vaultStore) List(dir string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := []string{}
+	for name := range s.files {
+		if d := path.Dir(name); d == dir || (d == "." && dir == "") {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (s *vaultStore) Dirs(dir string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	dirs := map[string]bool{}
+	for name := range s.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if seg := strings.SplitN(strings.TrimPrefix(name, prefix), "/", 2); len(seg) == 2 {
+			dirs[prefix+seg[0]] = true
+		}
+	}
+
+	out := []string{}
+	for d := range dirs {
+		out = append(out, d)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (s *vaultStore) Read(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.files[name]
+	if !ok {
+		return nil, notExist("read", name)
+	}
+	return append([]byte{}, f.Data...), nil
+}
+
+func (s *vaultStore) Write(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, existed := s.files[name]
+	s.files[name] = vaultFile{Data: append([]byte{}, data...), ModTime: time.Now().UTC()}
+	if s.held != nil {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		if existed {
+			s.files[name] = old
+		} else {
+			delete(s.files, name)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *vaultStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, existed := s.files[name]
+	if !existed {
+		return nil
+	}
+	delete(s.files, name)
+	if s.held != nil {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		s.files[name] = old
+		return err
+	}
+	return nil
+}
+
+func (s *vaultStore) Stat(name string) (StoreInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.files[name]
+	if !ok {
+		return StoreInfo{}, notExist("stat", name)
+	}
+	return StoreInfo{Size: int64(len(f.Data)), ModTime: f.ModTime}, nil
+}
+
+func (s *vaultStore) String() string {
+	return s.path
+}
+
+// Hold keeps all changes in memory until Flush writes them at once, calls
+// may be nested.
+func (s *vaultStore) Hold() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.holds++
+	if s.held != nil {
+		return
+	}
+	s.held = map[string]vaultFile{}
+	for name, f := range s.files {
+		s.held[name] = f
+	}
+}
+
+// Flush writes the changes held since the outermost Hold, they are discarded
+// if the vault cannot be written.
+func (s *vaultStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.holds > 0 {
+		s.holds--
+	}
+	held := s.held
+	if held == nil || s.holds > 0 {
+		return nil
+	}
+	s.held = nil
+	if vaultFilesEqual(held, s.files) {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		s.files = held
+		return err
+	}
+	return nil
+}
+
+func vaultFilesEqual(a, b map[string]vaultFile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, f := range a {
+		g, ok := b[name]
+		if !ok || !f.ModTime.Equal(g.ModTime) || !bytes.Equal(f.Data, g.Data) {
+			return false
+		}
+	}
+	return true
+}
+
+// save encrypts the vault for the user and the recipients listed in it and
+// replaces the vault file, unless another process changed it in the meantime.
+func (s *vaultStore) save() error {
+	c := s.crypt
+	if f, ok := s.files[recipientsFile]; ok {
+		rs, err := parseRecipients(f.Data)
+		if err != nil {
+			return fmt.Errorf("recipients file '%s' is malformed: %s", recipientsFile, err.Error())
+		}
+		for _, r := range rs {
+			c.AddRecipients(r)
+		}
+	}
+
+	plain, err := json.Marshal(s.files)
+	if err != nil {
+		return err
+	}
+	data, err := c.Encrypt(plain, vaultAssociatedData())
+	if err != nil {
+		return err
+	}
+
+	// the vault file is replaced on write, the lock is taken on a file next
+	// to it
+	lock, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("vault '%s' could not be locked: %s", s.path, err.Error())
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("vault '%s' could not be locked: %s", s.path, err.Error())
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	current, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		current = nil
+	} else if err != nil {
+		return fmt.Errorf("vault '%s' could not be read: %s", s.path, err.Error())
+	}
+	if !bytes.Equal(current, s.loaded) {
+		return fmt.Errorf("vault '%s' has been changed by another process, run the command again", s.path)
+	}
+
+	if err := writeFileAtomic(s.path, data, 0600); err != nil {
+		return err
+	}
+	s.loaded = data
+	return nil
+}
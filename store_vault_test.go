@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVaultStoreBatchesTransactions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pub, priv := testKeyPair(t, dir, "own")
+	c, err := NewCrypt("", pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pass := func() (*SecretBuffer, error) { return NewSecretBuffer(0), nil }
+	file := filepath.Join(dir, "bag.vault")
+
+	s, err := openVaultStore(file, c, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBag(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write("prod", "aws", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	before, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := b.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"prod", "test", "dev"} {
+		if err := tr.Write(name, "aws", []byte("2")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if during, err := ioutil.ReadFile(file); err != nil || !bytes.Equal(during, before) {
+		t.Fatalf("vault written before the transaction was committed: %v", err)
+	}
+	if err := tr.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openVaultStore(file, c, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"prod", "test", "dev"} {
+		data, err := reopened.Read(entryFileName(name, "aws"))
+		if err != nil || string(data) != "2" {
+			t.Fatalf("%s: unexpected content %q: %v", name, data, err)
+		}
+	}
+	if files, err := reopened.List(transactionDir); err != nil || len(files) != 0 {
+		t.Fatalf("staged files left in the vault: %v %v", files, err)
+	}
+
+	// a rolled back transaction leaves the vault as it was
+	after, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err = b.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Write("prod", "aws", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(file); err != nil || !bytes.Equal(data, after) {
+		t.Fatalf("vault written by a rolled back transaction: %v", err)
+	}
+}
+
+func TestVaultStoreRefusesConcurrentChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pub, priv := testKeyPair(t, dir, "own")
+	c, err := NewCrypt("", pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pass := func() (*SecretBuffer, error) { return NewSecretBuffer(0), nil }
+	file := filepath.Join(dir, "bag.vault")
+
+	first, err := openVaultStore(file, c, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := openVaultStore(file, c, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Write("prod.aws", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Write("test.aws", []byte("second")); err == nil {
+		t.Fatal("vault changed by another process overwritten")
+	}
+	if _, err := second.Read("test.aws"); !os.IsNotExist(err) {
+		t.Errorf("failed write kept in memory: %v", err)
+	}
+
+	reopened, err := openVaultStore(file, c, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := reopened.Read("prod.aws"); err != nil || string(data) != "first" {
+		t.Fatalf("unexpected content %q: %v", data, err)
+	}
+	if err := reopened.Write("test.aws", []byte("second")); err != nil {
+		t.Fatalf("vault read again could not be written: %s", err)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Tags are kept in the metadata of an entry, see metadata.go. Entries are
+// selected by their tags with a selector such as 'env=prod,team!=legacy'.
+
+var (
+	tagKeyRegexp   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_./-]*$`)
+	tagValueRegexp = regexp.MustCompile(`^[A-Za-z0-9_./:@-]*$`)
+)
+
+func checkTag(key, value string) error {
+	if !tagKeyRegexp.MatchString(key) {
+		return fmt.Errorf("invalid tag key '%s'", key)
+	}
+	if !tagValueRegexp.MatchString(value) {
+		return fmt.Errorf("invalid value '%s' of tag '%s'", value, key)
+	}
+	return nil
+}
+
+// parseTagChanges parses the arguments of 'scum tag', 'key=value' sets a tag
+// and 'key-' removes it.
+func parseTagChanges(args []string) (map[string]string, []string, error) {
+	set := map[string]string{}
+	remove := []string{}
+	for _, arg := range args {
+		if seg := strings.SplitN(arg, "=", 2); len(seg) == 2 {
+			if err := checkTag(seg[0], seg[1]); err != nil {
+				return nil, nil, err
+			}
+			set[seg[0]] = seg[1]
+			continue
+		}
+		key := strings.TrimSuffix(arg, "-")
+		if key == arg {
+			return nil, nil, fmt.Errorf("'%s' neither sets a tag (key=value) nor removes one (key-)", arg)
+		}
+		if err := checkTag(key, ""); err != nil {
+			return nil, nil, err
+		}
+		remove = append(remove, key)
+	}
+	return set, remove, nil
+}
+
+// formatTags lists the tags in selector syntax, sorted by key.
+func formatTags(tags map[string]string) string {
+	keys := []string{}
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := []string{}
+	for _, key := range keys {
+		out = append(out, key+"="+tags[key])
+	}
+	return strings.Join(out, ",")
+}
+
+// requirement is a single term of a selector.
+type requirement struct {
+	key   string
+	value string
+	// equal compares the value, otherwise only the presence of key matters
+	equal bool
+	not   bool
+}
+
+func (r requirement) matches(tags map[string]string) bool {
+	value, ok := tags[r.key]
+	if r.equal {
+		ok = ok && value == r.value
+	}
+	return ok != r.not
+}
+
+// selector matches the tags of an entry if all of its requirements do.
+type selector []requirement
+
+// parseSelector parses a comma separated list of 'key=value', 'key!=value',
+// 'key' (the tag is set) and '!key' (the tag is not set). An entry without
+// the tag key matches 'key!=value'.
+func parseSelector(s string) (selector, error) {
+	sel := selector{}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		r := requirement{}
+		switch {
+		case strings.Contains(term, "!="):
+			seg := strings.SplitN(term, "!=", 2)
+			r = requirement{key: seg[0], value: seg[1], equal: true, not: true}
+		case strings.Contains(term, "="):
+			seg := strings.SplitN(term, "=", 2)
+			r = requirement{key: seg[0], value: seg[1], equal: true}
+		case strings.HasPrefix(term, "!"):
+			r = requirement{key: strings.TrimPrefix(term, "!"), not: true}
+		default:
+			r = requirement{key: term}
+		}
+		if err := checkTag(r.key, r.value); err != nil {
+			return nil, fmt.Errorf("invalid selector '%s': %s", s, err.Error())
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+func (s selector) matches(tags map[string]string) bool {
+	for _, r := range s {
+		if !r.matches(tags) {
+			return false
+		}
+	}
+	return true
+}
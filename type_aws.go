@@ -4,9 +4,12 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/sts"
@@ -78,8 +81,8 @@ func (p *AWSProfile) Serialize() ([]byte, error) {
 	return json.MarshalIndent(p, "", "    ")
 }
 
-func (p *AWSProfile) Deserialize(in []byte) error {
-	return json.Unmarshal(in, p)
+func (p *AWSProfile) Deserialize(in *SecretBuffer) error {
+	return json.Unmarshal(in.Bytes(), p)
 }
 
 func (p *AWSProfile) String() string {
@@ -161,9 +164,16 @@ func (p *AWSProfile) VerifyCredentials() (string, bool) {
 }
 
 func (p *AWSProfile) getSession() (*session.Session, string, error) {
-	os.Setenv("AWS_ACCESS_KEY_ID", p.AWSAccessKeyID)
-	os.Setenv("AWS_SECRET_ACCESS_KEY", p.AWSSecretAccessKey)
-	sess := session.Must(session.NewSessionWithOptions(session.Options{}))
+	// several profiles may be verified at the same time, the credentials are
+	// therefore passed to the session instead of the environment and every
+	// session gets its own HTTP client (the SDK modifies the client if
+	// AWS_CA_BUNDLE is set)
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{
+			Credentials: credentials.NewStaticCredentials(p.AWSAccessKeyID, p.AWSSecretAccessKey, ""),
+			HTTPClient:  &http.Client{},
+		},
+	}))
 
 	// sts get-caller-identity
 	stsClient := sts.New(sess)